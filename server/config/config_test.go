@@ -0,0 +1,117 @@
+package config
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestTrustedProxies(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8, 192.0.2.5,not-a-proxy, ::ffff:198.51.100.1, 2001:db8::/32")
+	cfg := &Config{TrustedProxies: getEnvPrefixes("TRUSTED_PROXIES")}
+
+	if len(cfg.TrustedProxies) != 4 {
+		t.Fatalf("parsed %v, want 4 entries", cfg.TrustedProxies)
+	}
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"10.20.30.40", true},
+		{"11.0.0.1", false},
+		{"192.0.2.5", true},
+		{"192.0.2.6", false},
+		{"198.51.100.1", true},
+		{"::ffff:10.0.0.1", true},
+		{"2001:db8:1::1", true},
+		{"2001:db9::1", false},
+	}
+	for _, tt := range tests {
+		if got := cfg.IsTrustedProxy(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("IsTrustedProxy(%s) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestNoTrustedProxiesByDefault(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "")
+	cfg := &Config{TrustedProxies: getEnvPrefixes("TRUSTED_PROXIES")}
+	if cfg.IsTrustedProxy(netip.MustParseAddr("127.0.0.1")) {
+		t.Error("loopback trusted without configuration")
+	}
+}
+
+func TestMatchOrigin(t *testing.T) {
+	tests := []struct {
+		pattern, origin string
+		want            bool
+	}{
+		{"*", "https://anything.example", true},
+		{"https://frogs.cafe", "https://frogs.cafe", true},
+		{"https://frogs.cafe", "https://frogs.cafe.attacker.com", false},
+		{"https://*.frogs.cafe", "https://play.frogs.cafe", true},
+		{"https://*.frogs.cafe", "https://a.b.frogs.cafe", true},
+		{"https://*.frogs.cafe", "https://frogs.cafe", false},
+		{"https://*.frogs.cafe", "https://evil.frogs.cafe.attacker.com", false},
+		{"https://*.frogs.cafe", "https://evilfrogs.cafe", false},
+		{"https://*.frogs.cafe", "https://attacker.com/.frogs.cafe", false},
+		{"https://frogs.cafe", "http://frogs.cafe", false},
+		{"https://*.frogs.cafe", "http://play.frogs.cafe", false},
+		{"https://frogs.cafe", "https://frogs.cafe:8443", false},
+		{"https://frogs.cafe:8443", "https://frogs.cafe:8443", true},
+		{"https://frogs.cafe:8443", "https://frogs.cafe", false},
+		{"https://*.frogs.cafe", "https://play.frogs.cafe:8443", false},
+		{"http://localhost:3000", "http://localhost:5173", false},
+	}
+	for _, tt := range tests {
+		if got := matchOrigin(tt.pattern, tt.origin); got != tt.want {
+			t.Errorf("matchOrigin(%q, %q) = %v, want %v", tt.pattern, tt.origin, got, tt.want)
+		}
+	}
+}
+
+func TestDefaultOrigins(t *testing.T) {
+	tests := []struct {
+		environment string
+		allowed     []string
+		refused     []string
+	}{
+		{
+			environment: "",
+			refused:     []string{"http://localhost:3000", "https://example.com"},
+		},
+		{
+			environment: "production",
+			refused:     []string{"http://localhost:3000", "https://example.com"},
+		},
+		{
+			environment: "development",
+			allowed:     []string{"http://localhost:3000", "http://127.0.0.1:3000"},
+			refused:     []string{"http://localhost:8081", "https://example.com"},
+		},
+	}
+	for _, tt := range tests {
+		t.Setenv("ENVIRONMENT", tt.environment)
+		t.Setenv("ALLOWED_ORIGINS", "")
+		cfg := Load()
+		if cfg.AllowsAnyOrigin() {
+			t.Errorf("ENVIRONMENT=%q allows any origin by default", tt.environment)
+		}
+		for _, origin := range tt.allowed {
+			if !cfg.IsOriginAllowed(origin) {
+				t.Errorf("ENVIRONMENT=%q refuses %s", tt.environment, origin)
+			}
+		}
+		for _, origin := range tt.refused {
+			if cfg.IsOriginAllowed(origin) {
+				t.Errorf("ENVIRONMENT=%q allows %s", tt.environment, origin)
+			}
+		}
+	}
+}
+
+func TestAllowsAnyOrigin(t *testing.T) {
+	t.Setenv("ALLOWED_ORIGINS", "https://frogs.cafe, *")
+	if cfg := Load(); !cfg.AllowsAnyOrigin() {
+		t.Error("AllowsAnyOrigin() = false with * configured")
+	}
+}
@@ -9,6 +9,7 @@ import (
 
 type DB struct {
 	*sql.DB
+	connectionString string
 }
 
 func New(connectionString string) (*DB, error) {
@@ -21,7 +22,13 @@ func New(connectionString string) (*DB, error) {
 		return nil, fmt.Errorf("error connecting to database: %w", err)
 	}
 
-	return &DB{db}, nil
+	return &DB{DB: db, connectionString: connectionString}, nil
+}
+
+// ConnectionString returns the string the pool was opened with, for
+// components that need a dedicated connection of their own.
+func (db *DB) ConnectionString() string {
+	return db.connectionString
 }
 
 func (db *DB) Close() error {
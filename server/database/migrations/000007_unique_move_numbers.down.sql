@@ -0,0 +1 @@
+ALTER TABLE moves DROP CONSTRAINT IF EXISTS moves_game_id_move_number_key;
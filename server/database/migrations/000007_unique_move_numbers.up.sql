@@ -0,0 +1,10 @@
+-- Renumber any moves that were saved with duplicate numbers before the
+-- constraint existed, keeping the order in which they were inserted
+UPDATE moves SET move_number = renumbered.move_number
+FROM (
+	SELECT id, ROW_NUMBER() OVER (PARTITION BY game_id ORDER BY move_number, id) AS move_number
+	FROM moves
+) AS renumbered
+WHERE moves.id = renumbered.id AND moves.move_number <> renumbered.move_number;
+
+ALTER TABLE moves ADD CONSTRAINT moves_game_id_move_number_key UNIQUE (game_id, move_number);
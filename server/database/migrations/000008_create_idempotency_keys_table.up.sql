@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+	player_id INTEGER NOT NULL REFERENCES players(id) ON DELETE CASCADE,
+	idempotency_key VARCHAR(255) NOT NULL,
+	action VARCHAR(255) NOT NULL,
+	status_code INTEGER NOT NULL DEFAULT 0,
+	content_type VARCHAR(255) NOT NULL DEFAULT '',
+	response BYTEA,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (player_id, idempotency_key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_created_at ON idempotency_keys(created_at);
@@ -0,0 +1,3 @@
+DELETE FROM moves WHERE is_pass;
+ALTER TABLE moves DROP COLUMN IF EXISTS is_pass;
+ALTER TABLE moves DROP COLUMN IF EXISTS color;
@@ -0,0 +1,4 @@
+-- Imported games have no registered players, so each move records its own
+-- color. Passes have no point; their x and y are -1.
+ALTER TABLE moves ADD COLUMN IF NOT EXISTS color VARCHAR(5);
+ALTER TABLE moves ADD COLUMN IF NOT EXISTS is_pass BOOLEAN NOT NULL DEFAULT FALSE;
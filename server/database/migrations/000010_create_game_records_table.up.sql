@@ -0,0 +1,25 @@
+-- Game information from SGF files that has no home in games: names and
+-- ranks of players who may not have accounts, komi, handicap, rules, time
+-- settings and the original file, which keeps any variations.
+CREATE TABLE IF NOT EXISTS game_records (
+	game_id INTEGER PRIMARY KEY REFERENCES games(id) ON DELETE CASCADE,
+	name VARCHAR(255) NOT NULL DEFAULT '',
+	event VARCHAR(255) NOT NULL DEFAULT '',
+	place VARCHAR(255) NOT NULL DEFAULT '',
+	date VARCHAR(255) NOT NULL DEFAULT '',
+	black_name VARCHAR(255) NOT NULL DEFAULT '',
+	white_name VARCHAR(255) NOT NULL DEFAULT '',
+	black_rank VARCHAR(50) NOT NULL DEFAULT '',
+	white_rank VARCHAR(50) NOT NULL DEFAULT '',
+	komi REAL,
+	handicap INTEGER NOT NULL DEFAULT 0,
+	rules VARCHAR(255) NOT NULL DEFAULT '',
+	main_time REAL,
+	overtime VARCHAR(255) NOT NULL DEFAULT '',
+	result VARCHAR(255) NOT NULL DEFAULT '',
+	setup_black JSONB NOT NULL DEFAULT '[]',
+	setup_white JSONB NOT NULL DEFAULT '[]',
+	first_player VARCHAR(5) NOT NULL DEFAULT '',
+	source TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,33 @@
+-- Reviews study a finished or imported game as a tree of variations. The
+-- root node stands for the starting position; every other node is a move
+-- or pass played from its parent. The first child of a node is its main
+-- line, so children keep the order they were added in (by id).
+CREATE TABLE IF NOT EXISTS reviews (
+	id SERIAL PRIMARY KEY,
+	game_id INTEGER NOT NULL REFERENCES games(id) ON DELETE CASCADE,
+	owner_id INTEGER NOT NULL REFERENCES players(id) ON DELETE CASCADE,
+	title VARCHAR(255) NOT NULL DEFAULT '',
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_reviews_game_id ON reviews(game_id);
+
+CREATE TABLE IF NOT EXISTS review_nodes (
+	id SERIAL PRIMARY KEY,
+	review_id INTEGER NOT NULL REFERENCES reviews(id) ON DELETE CASCADE,
+	parent_id INTEGER REFERENCES review_nodes(id) ON DELETE CASCADE,
+	move_number INTEGER NOT NULL DEFAULT 0,
+	color VARCHAR(5) NOT NULL DEFAULT '',
+	x INTEGER NOT NULL DEFAULT -1,
+	y INTEGER NOT NULL DEFAULT -1,
+	is_pass BOOLEAN NOT NULL DEFAULT FALSE,
+	comment TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_review_nodes_review_id ON review_nodes(review_id);
+CREATE INDEX IF NOT EXISTS idx_review_nodes_parent_id ON review_nodes(parent_id);
+
+-- The node the owner is showing to viewers
+ALTER TABLE reviews ADD COLUMN IF NOT EXISTS current_node_id INTEGER REFERENCES review_nodes(id) ON DELETE SET NULL;
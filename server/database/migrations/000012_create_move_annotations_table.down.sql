@@ -0,0 +1 @@
+DROP TABLE IF EXISTS move_annotations;
@@ -0,0 +1,14 @@
+-- Comments and board markup that players and teachers attach to a move of
+-- a game. markup is a list of {"type", "x", "y", "label"} objects.
+CREATE TABLE IF NOT EXISTS move_annotations (
+	id SERIAL PRIMARY KEY,
+	game_id INTEGER NOT NULL REFERENCES games(id) ON DELETE CASCADE,
+	move_number INTEGER NOT NULL,
+	author_id INTEGER NOT NULL REFERENCES players(id) ON DELETE CASCADE,
+	comment TEXT NOT NULL DEFAULT '',
+	markup JSONB NOT NULL DEFAULT '[]',
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_move_annotations_game_id ON move_annotations(game_id, move_number);
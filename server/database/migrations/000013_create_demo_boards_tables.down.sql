@@ -0,0 +1 @@
+DROP TABLE IF EXISTS demo_actions, demo_presenters, demo_boards;
@@ -0,0 +1,32 @@
+-- Demonstration boards: free-form boards that presenters set up and play
+-- through for an audience. They are not games, so they never show up in
+-- the game list or affect ratings. The position is the result of replaying
+-- demo_actions in seq order; undo deletes the last action.
+CREATE TABLE IF NOT EXISTS demo_boards (
+	id SERIAL PRIMARY KEY,
+	owner_id INTEGER NOT NULL REFERENCES players(id) ON DELETE CASCADE,
+	title VARCHAR(255) NOT NULL DEFAULT '',
+	board_size INTEGER NOT NULL DEFAULT 19,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Players other than the owner who may change the board
+CREATE TABLE IF NOT EXISTS demo_presenters (
+	demo_id INTEGER NOT NULL REFERENCES demo_boards(id) ON DELETE CASCADE,
+	player_id INTEGER NOT NULL REFERENCES players(id) ON DELETE CASCADE,
+	PRIMARY KEY (demo_id, player_id)
+);
+
+CREATE TABLE IF NOT EXISTS demo_actions (
+	demo_id INTEGER NOT NULL REFERENCES demo_boards(id) ON DELETE CASCADE,
+	seq INTEGER NOT NULL,
+	type VARCHAR(10) NOT NULL,
+	color VARCHAR(5) NOT NULL DEFAULT '',
+	x INTEGER NOT NULL DEFAULT -1,
+	y INTEGER NOT NULL DEFAULT -1,
+	black JSONB NOT NULL DEFAULT '[]',
+	white JSONB NOT NULL DEFAULT '[]',
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (demo_id, seq)
+);
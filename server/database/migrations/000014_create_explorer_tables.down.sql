@@ -0,0 +1 @@
+DROP TABLE IF EXISTS explorer_indexed_games, explorer_moves;
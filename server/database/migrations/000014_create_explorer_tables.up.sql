@@ -0,0 +1,20 @@
+-- Opening explorer index. Each row counts the finished games in which a
+-- move followed an opening sequence. prefix and move are SGF points in the
+-- sequence's canonical orientation, so games that differ only by a board
+-- symmetry share rows. rating_total sums both players' ratings per game.
+CREATE TABLE IF NOT EXISTS explorer_moves (
+	board_size INTEGER NOT NULL,
+	prefix TEXT NOT NULL,
+	move VARCHAR(2) NOT NULL,
+	games INTEGER NOT NULL DEFAULT 0,
+	black_wins INTEGER NOT NULL DEFAULT 0,
+	white_wins INTEGER NOT NULL DEFAULT 0,
+	rating_total BIGINT NOT NULL DEFAULT 0,
+	PRIMARY KEY (board_size, prefix, move)
+);
+
+-- Games already counted in explorer_moves, so each is added once
+CREATE TABLE IF NOT EXISTS explorer_indexed_games (
+	game_id INTEGER PRIMARY KEY REFERENCES games(id) ON DELETE CASCADE,
+	indexed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
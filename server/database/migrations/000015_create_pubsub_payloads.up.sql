@@ -0,0 +1,10 @@
+-- Pub/sub events too large for a Postgres NOTIFY. The notification carries
+-- the row's id and listeners read the payload from here. Rows are only
+-- needed until every instance has read them and are deleted after a while.
+CREATE TABLE IF NOT EXISTS pubsub_payloads (
+	id BIGSERIAL PRIMARY KEY,
+	payload TEXT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_pubsub_payloads_created_at ON pubsub_payloads(created_at);
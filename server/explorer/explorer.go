@@ -0,0 +1,119 @@
+// Package explorer turns opening move sequences into keys for the opening
+// explorer. Sequences that are the same up to one of the eight symmetries
+// of the board share a key, so that, say, every opening on a 4-4 point is
+// counted together.
+package explorer
+
+import (
+	"strings"
+
+	"frogs_cafe/rules"
+	"frogs_cafe/sgf"
+)
+
+// MaxDepth is the number of opening moves indexed per game.
+const MaxDepth = 40
+
+// Symmetry is one of the eight symmetries of a square board: the rotations
+// by 0, 90, 180 and 270 degrees, then the reflections in the vertical
+// axis, the horizontal axis and the two diagonals.
+type Symmetry int
+
+// Symmetries lists every symmetry, the identity first.
+var Symmetries = [8]Symmetry{0, 1, 2, 3, 4, 5, 6, 7}
+
+// Apply maps p on a board of the given size.
+func (s Symmetry) Apply(p rules.Point, size int) rules.Point {
+	n := size - 1
+	switch s {
+	case 1:
+		return rules.Point{X: n - p.Y, Y: p.X}
+	case 2:
+		return rules.Point{X: n - p.X, Y: n - p.Y}
+	case 3:
+		return rules.Point{X: p.Y, Y: n - p.X}
+	case 4:
+		return rules.Point{X: n - p.X, Y: p.Y}
+	case 5:
+		return rules.Point{X: p.X, Y: n - p.Y}
+	case 6:
+		return rules.Point{X: p.Y, Y: p.X}
+	case 7:
+		return rules.Point{X: n - p.Y, Y: n - p.X}
+	default:
+		return p
+	}
+}
+
+// Inverse returns the symmetry that undoes s.
+func (s Symmetry) Inverse() Symmetry {
+	switch s {
+	case 1:
+		return 3
+	case 3:
+		return 1
+	default:
+		return s
+	}
+}
+
+// Canonical returns the key of a move sequence: its SGF points, in the
+// orientation whose encoding sorts first. It also returns every symmetry
+// that maps moves onto that orientation; there is more than one when the
+// sequence is itself symmetric, such as the empty one.
+func Canonical(size int, moves []rules.Point) (string, []Symmetry) {
+	var key string
+	var syms []Symmetry
+	for _, s := range Symmetries {
+		encoded := encode(size, moves, s)
+		switch {
+		case syms == nil || encoded < key:
+			key, syms = encoded, []Symmetry{s}
+		case encoded == key:
+			syms = append(syms, s)
+		}
+	}
+	return key, syms
+}
+
+// Continuation returns the key of move played after a sequence whose
+// canonical symmetries are syms. Moves that are equivalent given the
+// sequence, such as the four 4-4 points on an empty board, share a key.
+func Continuation(size int, move rules.Point, syms []Symmetry) string {
+	var key string
+	for i, s := range syms {
+		p := s.Apply(move, size)
+		if encoded := sgf.Point(p.X, p.Y); i == 0 || encoded < key {
+			key = encoded
+		}
+	}
+	return key
+}
+
+// Entry is one opening sequence and the move that followed it, as keys.
+type Entry struct {
+	Prefix string
+	Move   string
+}
+
+// Entries returns the entries a game with the given opening adds to the
+// index: one per move, up to MaxDepth.
+func Entries(size int, moves []rules.Point) []Entry {
+	moves = moves[:min(len(moves), MaxDepth)]
+	entries := make([]Entry, len(moves))
+	for i, move := range moves {
+		prefix, syms := Canonical(size, moves[:i])
+		entries[i] = Entry{Prefix: prefix, Move: Continuation(size, move, syms)}
+	}
+	return entries
+}
+
+func encode(size int, moves []rules.Point, s Symmetry) string {
+	var b strings.Builder
+	b.Grow(2 * len(moves))
+	for _, move := range moves {
+		p := s.Apply(move, size)
+		b.WriteString(sgf.Point(p.X, p.Y))
+	}
+	return b.String()
+}
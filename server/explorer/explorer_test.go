@@ -0,0 +1,119 @@
+package explorer
+
+import (
+	"reflect"
+	"testing"
+
+	"frogs_cafe/rules"
+	"frogs_cafe/sgf"
+)
+
+// opening is an asymmetric 19x19 opening, so each symmetry gives a
+// different sequence.
+var opening = []rules.Point{{X: 15, Y: 3}, {X: 3, Y: 15}, {X: 16, Y: 15}, {X: 2, Y: 3}, {X: 13, Y: 2}}
+
+func transform(s Symmetry, size int, moves []rules.Point) []rules.Point {
+	out := make([]rules.Point, len(moves))
+	for i, m := range moves {
+		out[i] = s.Apply(m, size)
+	}
+	return out
+}
+
+func TestSymmetricOpeningsShareKeys(t *testing.T) {
+	const size = 19
+	wantKey, _ := Canonical(size, opening)
+	wantEntries := Entries(size, opening)
+
+	seen := map[string]bool{}
+	for _, s := range Symmetries {
+		moves := transform(s, size, opening)
+		seen[encode(size, moves, 0)] = true
+
+		if key, _ := Canonical(size, moves); key != wantKey {
+			t.Errorf("symmetry %d: key %q, want %q", s, key, wantKey)
+		}
+		if entries := Entries(size, moves); !reflect.DeepEqual(entries, wantEntries) {
+			t.Errorf("symmetry %d: entries %v, want %v", s, entries, wantEntries)
+		}
+	}
+	if len(seen) != len(Symmetries) {
+		t.Errorf("the eight symmetries gave only %d distinct openings", len(seen))
+	}
+}
+
+func TestInverse(t *testing.T) {
+	for _, size := range []int{9, 19, 4} {
+		for _, s := range Symmetries {
+			inverse := s.Inverse()
+			for y := range size {
+				for x := range size {
+					p := rules.Point{X: x, Y: y}
+					if got := inverse.Apply(s.Apply(p, size), size); got != p {
+						t.Fatalf("size %d: Inverse(%d) after %d maps %v to %v", size, s, s, p, got)
+					}
+					if got := s.Apply(inverse.Apply(p, size), size); got != p {
+						t.Fatalf("size %d: %d after Inverse(%d) maps %v to %v", size, s, s, p, got)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestEmptyBoardContinuations(t *testing.T) {
+	const size = 19
+	prefix, syms := Canonical(size, nil)
+	if prefix != "" || len(syms) != len(Symmetries) {
+		t.Fatalf("Canonical(empty) = %q with %d symmetries, want \"\" with 8", prefix, len(syms))
+	}
+
+	// The four 4-4 points are one move on an empty board, and so are the
+	// eight 3-4 points
+	hoshi := []rules.Point{{X: 3, Y: 3}, {X: 15, Y: 3}, {X: 3, Y: 15}, {X: 15, Y: 15}}
+	komoku := []rules.Point{{X: 2, Y: 3}, {X: 3, Y: 2}, {X: 16, Y: 3}, {X: 15, Y: 2}, {X: 2, Y: 15}, {X: 3, Y: 16}, {X: 16, Y: 15}, {X: 15, Y: 16}}
+	for _, group := range [][]rules.Point{hoshi, komoku} {
+		want := Continuation(size, group[0], syms)
+		for _, p := range group[1:] {
+			if got := Continuation(size, p, syms); got != want {
+				t.Errorf("Continuation(%v) = %q, want %q", p, got, want)
+			}
+		}
+	}
+	if Continuation(size, hoshi[0], syms) == Continuation(size, komoku[0], syms) {
+		t.Error("4-4 and 3-4 share a key")
+	}
+}
+
+func TestContinuationsMapBack(t *testing.T) {
+	// A continuation read from the index, turned back to the caller's
+	// orientation as the explorer endpoint does, is equivalent to the move
+	// the caller would play
+	const size = 19
+	next := rules.Point{X: 16, Y: 2}
+	for _, s := range Symmetries {
+		moves := transform(s, size, opening)
+		move := s.Apply(next, size)
+
+		prefix, syms := Canonical(size, moves)
+		key := Continuation(size, move, syms)
+		p, err := sgf.ParsePoint(key, size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		back := syms[0].Inverse().Apply(p, size)
+		if back != move {
+			t.Errorf("symmetry %d: continuation %q maps back to %v, want %v (prefix %q)", s, key, back, move, prefix)
+		}
+	}
+}
+
+func TestEntriesStopAtMaxDepth(t *testing.T) {
+	moves := make([]rules.Point, MaxDepth+5)
+	for i := range moves {
+		moves[i] = rules.Point{X: i % 19, Y: i / 19}
+	}
+	if got := len(Entries(19, moves)); got != MaxDepth {
+		t.Errorf("%d entries, want %d", got, MaxDepth)
+	}
+}
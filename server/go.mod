@@ -12,6 +12,7 @@ require (
 	github.com/joho/godotenv v1.5.1
 	github.com/lib/pq v1.10.9
 	golang.org/x/crypto v0.45.0
+	golang.org/x/text v0.31.0
 )
 
 require golang.org/x/net v0.47.0 // indirect
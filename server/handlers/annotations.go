@@ -0,0 +1,357 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"frogs_cafe/middleware"
+	"frogs_cafe/models"
+	"frogs_cafe/rules"
+	"frogs_cafe/sgf"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	maxAnnotationLength = 5000 // Characters in a comment
+	maxAnnotationMarkup = 200  // Marks per annotation
+	maxMarkupLabel      = 8    // Characters in a label
+)
+
+// CreateAnnotation attaches a comment and markup to a move of a game. Any
+// player may annotate any game that is not in progress.
+func (h *Handler) CreateAnnotation(w http.ResponseWriter, r *http.Request) {
+	playerID, ok := middleware.GetPlayerID(r)
+	if !ok {
+		http.Error(w, "Unauthorized: Player ID not found", http.StatusUnauthorized)
+		return
+	}
+
+	gameID := chi.URLParam(r, "gameID")
+	id, err := strconv.Atoi(gameID)
+	if err != nil {
+		http.Error(w, "Invalid game ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.AnnotationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	game, err := h.getGame(id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Game not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// Keep players from being coached mid-game
+	if game.Status == "waiting" || game.Status == "active" {
+		http.Error(w, "Games in progress cannot be annotated", http.StatusConflict)
+		return
+	}
+	if msg := validateAnnotation(&req, game.BoardSize); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	var exists bool
+	err = h.db.QueryRow("SELECT EXISTS (SELECT 1 FROM moves WHERE game_id = $1 AND move_number = $2)", id, req.MoveNumber).Scan(&exists)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, fmt.Sprintf("Game has no move %d", req.MoveNumber), http.StatusBadRequest)
+		return
+	}
+
+	markup, err := json.Marshal(req.Markup)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	annotation, err := scanAnnotation(h.db.QueryRow(
+		`WITH a AS (
+			INSERT INTO move_annotations (game_id, move_number, author_id, comment, markup) VALUES ($1, $2, $3, $4, $5)
+			RETURNING id, game_id, move_number, author_id, comment, markup, created_at, updated_at
+		)
+		SELECT a.id, a.game_id, a.move_number, a.author_id, p.username, a.comment, a.markup, a.created_at, a.updated_at
+		FROM a JOIN players p ON p.id = a.author_id`,
+		id, req.MoveNumber, playerID, req.Comment, markup,
+	))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(annotation); err != nil {
+		log.Printf("Failed to encode annotation response: %v", err)
+	}
+}
+
+// UpdateAnnotation replaces the comment and markup of an annotation. Only
+// its author may change it.
+func (h *Handler) UpdateAnnotation(w http.ResponseWriter, r *http.Request) {
+	playerID, ok := middleware.GetPlayerID(r)
+	if !ok {
+		http.Error(w, "Unauthorized: Player ID not found", http.StatusUnauthorized)
+		return
+	}
+	gameID, annotationID, ok := annotationParams(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.AnnotationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	existing, ok := h.authoredAnnotation(w, gameID, annotationID, playerID)
+	if !ok {
+		return
+	}
+	game, err := h.getGame(gameID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	req.MoveNumber = existing.MoveNumber
+	if msg := validateAnnotation(&req, game.BoardSize); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	markup, err := json.Marshal(req.Markup)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_, err = h.db.Exec(
+		"UPDATE move_annotations SET comment = $1, markup = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $3",
+		req.Comment, markup, annotationID,
+	)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	annotation, err := h.getAnnotation(gameID, annotationID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(annotation); err != nil {
+		log.Printf("Failed to encode annotation response: %v", err)
+	}
+}
+
+// DeleteAnnotation removes an annotation. Only its author may remove it.
+func (h *Handler) DeleteAnnotation(w http.ResponseWriter, r *http.Request) {
+	playerID, ok := middleware.GetPlayerID(r)
+	if !ok {
+		http.Error(w, "Unauthorized: Player ID not found", http.StatusUnauthorized)
+		return
+	}
+	gameID, annotationID, ok := annotationParams(w, r)
+	if !ok {
+		return
+	}
+
+	if _, ok := h.authoredAnnotation(w, gameID, annotationID, playerID); !ok {
+		return
+	}
+	if _, err := h.db.Exec("DELETE FROM move_annotations WHERE id = $1", annotationID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// validateAnnotation checks an annotation for a board of size and tidies
+// it up, returning why it is refused or "" if it is fine.
+func validateAnnotation(req *models.AnnotationRequest, size int) string {
+	req.Comment = strings.TrimSpace(req.Comment)
+	if utf8.RuneCountInString(req.Comment) > maxAnnotationLength {
+		return fmt.Sprintf("Comment must be at most %d characters", maxAnnotationLength)
+	}
+	if req.Comment == "" && len(req.Markup) == 0 {
+		return "An annotation needs a comment or markup"
+	}
+	if len(req.Markup) > maxAnnotationMarkup {
+		return fmt.Sprintf("An annotation may have at most %d marks", maxAnnotationMarkup)
+	}
+	if req.Markup == nil {
+		req.Markup = []models.Markup{}
+	}
+
+	for i := range req.Markup {
+		m := &req.Markup[i]
+		if m.X < 0 || m.Y < 0 || m.X >= size || m.Y >= size {
+			return fmt.Sprintf("Mark at %d,%d is off the board", m.X, m.Y)
+		}
+		switch m.Type {
+		case models.MarkupTriangle, models.MarkupSquare, models.MarkupCircle:
+			m.Label = ""
+		case models.MarkupLabel:
+			m.Label = strings.TrimSpace(m.Label)
+			if m.Label == "" || utf8.RuneCountInString(m.Label) > maxMarkupLabel {
+				return fmt.Sprintf("Labels must be 1-%d characters", maxMarkupLabel)
+			}
+		default:
+			return fmt.Sprintf("Unknown markup type %q", m.Type)
+		}
+	}
+	return ""
+}
+
+// annotationParams parses the game and annotation IDs in the URL, answering
+// 400 if either is not a number.
+func annotationParams(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	gameID, err := strconv.Atoi(chi.URLParam(r, "gameID"))
+	if err != nil {
+		http.Error(w, "Invalid game ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	annotationID, err := strconv.Atoi(chi.URLParam(r, "annotationID"))
+	if err != nil {
+		http.Error(w, "Invalid annotation ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	return gameID, annotationID, true
+}
+
+// authoredAnnotation loads an annotation that playerID wrote, answering the
+// request itself if there is no such annotation or someone else wrote it.
+func (h *Handler) authoredAnnotation(w http.ResponseWriter, gameID, annotationID, playerID int) (models.Annotation, bool) {
+	annotation, err := h.getAnnotation(gameID, annotationID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Annotation not found", http.StatusNotFound)
+		return models.Annotation{}, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return models.Annotation{}, false
+	}
+	if annotation.AuthorID != playerID {
+		http.Error(w, "Only the author can change an annotation", http.StatusForbidden)
+		return models.Annotation{}, false
+	}
+	return annotation, true
+}
+
+func (h *Handler) getAnnotation(gameID, annotationID int) (models.Annotation, error) {
+	return scanAnnotation(h.db.QueryRow(
+		`SELECT a.id, a.game_id, a.move_number, a.author_id, p.username, a.comment, a.markup, a.created_at, a.updated_at
+		FROM move_annotations a JOIN players p ON p.id = a.author_id
+		WHERE a.id = $1 AND a.game_id = $2`,
+		annotationID, gameID,
+	))
+}
+
+// getAnnotations loads the annotations of a game by move, oldest first.
+func (h *Handler) getAnnotations(gameID int) ([]models.Annotation, error) {
+	rows, err := h.db.Query(
+		`SELECT a.id, a.game_id, a.move_number, a.author_id, p.username, a.comment, a.markup, a.created_at, a.updated_at
+		FROM move_annotations a JOIN players p ON p.id = a.author_id
+		WHERE a.game_id = $1 ORDER BY a.move_number, a.id`,
+		gameID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Failed to close rows: %v", err)
+		}
+	}()
+
+	var annotations []models.Annotation
+	for rows.Next() {
+		annotation, err := scanAnnotation(rows)
+		if err != nil {
+			return nil, err
+		}
+		annotations = append(annotations, annotation)
+	}
+	return annotations, rows.Err()
+}
+
+func scanAnnotation(row interface{ Scan(...interface{}) error }) (models.Annotation, error) {
+	var a models.Annotation
+	var markup []byte
+	err := row.Scan(&a.ID, &a.GameID, &a.MoveNumber, &a.AuthorID, &a.AuthorName, &a.Comment, &markup, &a.CreatedAt, &a.UpdatedAt)
+	if err != nil {
+		return models.Annotation{}, err
+	}
+	if err := json.Unmarshal(markup, &a.Markup); err != nil {
+		return models.Annotation{}, err
+	}
+	return a, nil
+}
+
+// attachAnnotations hands each annotation to the move it belongs to.
+func attachAnnotations(moves []models.Move, annotations []models.Annotation) {
+	index := make(map[int]int, len(moves))
+	for i, m := range moves {
+		index[m.MoveNumber] = i
+	}
+	for _, a := range annotations {
+		if i, ok := index[a.MoveNumber]; ok {
+			moves[i].Annotations = append(moves[i].Annotations, a)
+		}
+	}
+}
+
+// sgfMarkupProperties maps markup types to SGF properties.
+var sgfMarkupProperties = map[string]string{
+	models.MarkupTriangle: "TR",
+	models.MarkupSquare:   "SQ",
+	models.MarkupCircle:   "CR",
+	models.MarkupLabel:    "LB",
+}
+
+// addAnnotations writes annotations on node: their comments, signed by
+// their authors, as C, and their markup as TR, SQ, CR and LB. SGF allows
+// one mark per point, so the earliest annotation wins.
+func addAnnotations(node *sgf.Node, game models.Game, annotations []models.Annotation) {
+	var comments []string
+	marked := make(map[rules.Point]bool)
+	for _, a := range annotations {
+		if a.Comment != "" {
+			comments = append(comments, a.AuthorName+": "+a.Comment)
+		}
+		for _, m := range a.Markup {
+			p := rules.Point{X: m.X, Y: m.Y}
+			id, ok := sgfMarkupProperties[m.Type]
+			if !ok || marked[p] || !sgfOnBoard(game, p) {
+				continue
+			}
+			marked[p] = true
+			value := sgf.Point(m.X, m.Y)
+			if m.Type == models.MarkupLabel {
+				value += ":" + m.Label
+			}
+			node.Add(id, value)
+		}
+	}
+	if len(comments) > 0 {
+		node.Add("C", strings.Join(comments, "\n\n"))
+	}
+}
@@ -0,0 +1,656 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"frogs_cafe/middleware"
+	"frogs_cafe/models"
+	"frogs_cafe/rules"
+	"frogs_cafe/sgf"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/lib/pq"
+)
+
+const (
+	maxDemoTitleLength = 255
+	maxDemoActions     = 5000 // Per board, so replaying one stays cheap
+)
+
+// demoError is a demo board change refused by validation.
+type demoError struct {
+	status  int
+	message string
+}
+
+func (e *demoError) Error() string {
+	return e.message
+}
+
+// writeDemoError reports err, logging anything that is not a refusal.
+func writeDemoError(w http.ResponseWriter, err error) {
+	var dErr *demoError
+	if errors.As(err, &dErr) {
+		http.Error(w, dErr.message, dErr.status)
+		return
+	}
+	log.Printf("Error updating demo board: %v", err)
+	http.Error(w, "Internal server error", http.StatusInternalServerError)
+}
+
+// CreateDemo opens an empty demo board owned by the caller.
+func (h *Handler) CreateDemo(w http.ResponseWriter, r *http.Request) {
+	playerID, ok := middleware.GetPlayerID(r)
+	if !ok {
+		http.Error(w, "Unauthorized: Player ID not found", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.CreateDemoRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.BoardSize == 0 {
+		req.BoardSize = 19
+	}
+	if req.BoardSize < 2 || req.BoardSize > sgf.MaxBoardSize {
+		http.Error(w, fmt.Sprintf("Board size must be between 2 and %d", sgf.MaxBoardSize), http.StatusBadRequest)
+		return
+	}
+	req.Title = strings.TrimSpace(req.Title)
+	if utf8.RuneCountInString(req.Title) > maxDemoTitleLength {
+		http.Error(w, fmt.Sprintf("Title must be at most %d characters", maxDemoTitleLength), http.StatusBadRequest)
+		return
+	}
+
+	demo := models.DemoBoard{OwnerID: playerID, Title: req.Title, BoardSize: req.BoardSize, Presenters: []int{}}
+	err := h.db.QueryRow(
+		"INSERT INTO demo_boards (owner_id, title, board_size) VALUES ($1, $2, $3) RETURNING id, created_at, updated_at",
+		playerID, req.Title, req.BoardSize,
+	).Scan(&demo.ID, &demo.CreatedAt, &demo.UpdatedAt)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(demoState(demo, nil)); err != nil {
+		log.Printf("Failed to encode demo response: %v", err)
+	}
+}
+
+// ListDemos returns every demo board, most recently changed first.
+func (h *Handler) ListDemos(w http.ResponseWriter, r *http.Request) {
+	rows, err := h.db.Query(
+		`SELECT d.id, d.owner_id, d.title, d.board_size, d.created_at, d.updated_at,
+			COALESCE(array_agg(p.player_id ORDER BY p.player_id) FILTER (WHERE p.player_id IS NOT NULL), '{}')
+		FROM demo_boards d LEFT JOIN demo_presenters p ON p.demo_id = d.id
+		GROUP BY d.id ORDER BY d.updated_at DESC`,
+	)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Failed to close rows: %v", err)
+		}
+	}()
+
+	var demos []models.DemoBoard
+	for rows.Next() {
+		demo, err := scanDemo(rows)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		demos = append(demos, demo)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(demos); err != nil {
+		log.Printf("Failed to encode demos response: %v", err)
+	}
+}
+
+// GetDemo returns a demo board and its current position.
+func (h *Handler) GetDemo(w http.ResponseWriter, r *http.Request) {
+	demo, actions, ok := h.loadDemo(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(demoState(demo, actions)); err != nil {
+		log.Printf("Failed to encode demo response: %v", err)
+	}
+}
+
+// GetDemoSGF returns a demo board as an SGF file with one node per action,
+// so the lecture can be stepped through afterwards.
+func (h *Handler) GetDemoSGF(w http.ResponseWriter, r *http.Request) {
+	demo, actions, ok := h.loadDemo(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-go-sgf; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("frogs-cafe-demo-%d.sgf", demo.ID)))
+	if err := sgf.Encode(w, demoRecord(demo, actions)); err != nil {
+		log.Printf("Failed to write SGF for demo %d: %v", demo.ID, err)
+	}
+}
+
+// demoRecord builds the SGF tree of a demo board with a node per action.
+// Plays become moves; other changes become AB, AW and AE.
+func demoRecord(demo models.DemoBoard, actions []models.DemoAction) *sgf.Node {
+	root := &sgf.Node{}
+	root.Add("FF", "4")
+	root.Add("GM", "1")
+	root.Add("CA", "UTF-8")
+	root.Add("AP", "Frogs Café")
+	root.Add("SZ", strconv.Itoa(demo.BoardSize))
+	if demo.Title != "" {
+		root.Add("GN", demo.Title)
+	}
+	root.Add("PC", "Frogs Café")
+	root.Add("DT", demo.CreatedAt.Format("2006-01-02"))
+
+	board := rules.NewBoard(demo.BoardSize)
+	node := root
+	for _, a := range actions {
+		before := board.Clone()
+		after, err := applyDemoAction(board, a)
+		if err != nil {
+			log.Printf("Demo #%d action %d: %v, skipping", demo.ID, a.Seq, err)
+			board = before
+			continue
+		}
+		board = after
+
+		var change *sgf.Node
+		if a.Type == models.DemoPlay {
+			change = sgfMove(rules.ParseColor(a.Color), a.X, a.Y, false)
+		} else {
+			change = setupChanges(before, after)
+			if a.Type == models.DemoSetup && a.Color != "" {
+				change.Add("PL", sgfColor(rules.ParseColor(a.Color)))
+			}
+		}
+		if len(change.Properties) > 0 {
+			node = node.AddChild(change)
+		}
+	}
+	return root
+}
+
+// setupChanges returns a node with the AB, AW and AE properties that turn
+// the position before into after.
+func setupChanges(before, after *rules.Board) *sgf.Node {
+	node := &sgf.Node{}
+	for y := range after.Size() {
+		for x := range after.Size() {
+			c := after.At(x, y)
+			if c == before.At(x, y) {
+				continue
+			}
+			switch c {
+			case rules.Empty:
+				node.Add("AE", sgf.Point(x, y))
+			default:
+				node.Add("A"+sgfColor(c), sgf.Point(x, y))
+			}
+		}
+	}
+	return node
+}
+
+// AddDemoAction changes a demo board and shows the new position to
+// everyone following it. Presenters only.
+func (h *Handler) AddDemoAction(w http.ResponseWriter, r *http.Request) {
+	playerID, ok := middleware.GetPlayerID(r)
+	if !ok {
+		http.Error(w, "Unauthorized: Player ID not found", http.StatusUnauthorized)
+		return
+	}
+	demoID, ok := demoIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.DemoActionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	state, err := h.changeDemo(demoID, playerID, func(tx *sql.Tx, demo models.DemoBoard, actions []models.DemoAction) ([]models.DemoAction, error) {
+		return addDemoAction(tx, demo, actions, req)
+	})
+	if err != nil {
+		writeDemoError(w, err)
+		return
+	}
+	respondDemoState(w, http.StatusCreated, state)
+}
+
+// UndoDemoAction takes back the last change to a demo board. Presenters
+// only.
+func (h *Handler) UndoDemoAction(w http.ResponseWriter, r *http.Request) {
+	playerID, ok := middleware.GetPlayerID(r)
+	if !ok {
+		http.Error(w, "Unauthorized: Player ID not found", http.StatusUnauthorized)
+		return
+	}
+	demoID, ok := demoIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	state, err := h.changeDemo(demoID, playerID, func(tx *sql.Tx, demo models.DemoBoard, actions []models.DemoAction) ([]models.DemoAction, error) {
+		if len(actions) == 0 {
+			return nil, &demoError{http.StatusConflict, "Nothing to undo"}
+		}
+		last := actions[len(actions)-1]
+		if _, err := tx.Exec("DELETE FROM demo_actions WHERE demo_id = $1 AND seq = $2", demo.ID, last.Seq); err != nil {
+			return nil, err
+		}
+		return actions[:len(actions)-1], nil
+	})
+	if err != nil {
+		writeDemoError(w, err)
+		return
+	}
+	respondDemoState(w, http.StatusOK, state)
+}
+
+// addDemoAction checks req against the position after actions and stores
+// it as the next action.
+func addDemoAction(tx *sql.Tx, demo models.DemoBoard, actions []models.DemoAction, req models.DemoActionRequest) ([]models.DemoAction, error) {
+	if len(actions) >= maxDemoActions {
+		return nil, &demoError{http.StatusConflict, fmt.Sprintf("A demo board holds at most %d actions; clear it or start another", maxDemoActions)}
+	}
+
+	board, err := replayDemo(demo, actions)
+	if err != nil {
+		return nil, err
+	}
+
+	action := models.DemoAction{Seq: 1, Type: req.Type, X: -1, Y: -1}
+	if len(actions) > 0 {
+		action.Seq = actions[len(actions)-1].Seq + 1
+	}
+	color := rules.ParseColor(req.Color)
+	if req.Color != "" && color == rules.Empty {
+		return nil, &demoError{http.StatusBadRequest, `Color must be "black" or "white"`}
+	}
+
+	switch req.Type {
+	case models.DemoPlay:
+		if color == rules.Empty {
+			color = board.Next()
+		}
+		action.X, action.Y = req.X, req.Y
+	case models.DemoPlace:
+		if color == rules.Empty {
+			return nil, &demoError{http.StatusBadRequest, "Placing a stone needs a color"}
+		}
+		action.X, action.Y = req.X, req.Y
+	case models.DemoRemove:
+		action.X, action.Y = req.X, req.Y
+	case models.DemoClear:
+		color = rules.Empty
+	case models.DemoSetup:
+		action.Black, action.White = req.Black, req.White
+	default:
+		return nil, &demoError{http.StatusBadRequest, fmt.Sprintf("Unknown action type %q", req.Type)}
+	}
+	action.Color = color.String()
+
+	if _, err := applyDemoAction(board, action); err != nil {
+		return nil, &demoError{http.StatusUnprocessableEntity, err.Error()}
+	}
+
+	black, err := json.Marshal(pointsOrEmpty(action.Black))
+	if err != nil {
+		return nil, err
+	}
+	white, err := json.Marshal(pointsOrEmpty(action.White))
+	if err != nil {
+		return nil, err
+	}
+	err = tx.QueryRow(
+		"INSERT INTO demo_actions (demo_id, seq, type, color, x, y, black, white) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING created_at",
+		demo.ID, action.Seq, action.Type, action.Color, action.X, action.Y, black, white,
+	).Scan(&action.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return append(actions, action), nil
+}
+
+// applyDemoAction returns the board after action. The board passed in may
+// be changed, or replaced by a new one for clear and setup.
+func applyDemoAction(board *rules.Board, action models.DemoAction) (*rules.Board, error) {
+	color := rules.ParseColor(action.Color)
+	switch action.Type {
+	case models.DemoPlay:
+		board.SetNext(color)
+		if _, err := board.Play(color, action.X, action.Y); err != nil {
+			return nil, fmt.Errorf("illegal move: %w", err)
+		}
+	case models.DemoPlace:
+		if err := board.Place(color, action.X, action.Y); err != nil {
+			return nil, err
+		}
+	case models.DemoRemove:
+		if board.At(action.X, action.Y) == rules.Empty {
+			return nil, errors.New("there is no stone to remove")
+		}
+		if err := board.Place(rules.Empty, action.X, action.Y); err != nil {
+			return nil, err
+		}
+	case models.DemoClear, models.DemoSetup:
+		cleared := rules.NewBoard(board.Size())
+		for _, stones := range []struct {
+			color  rules.Color
+			points []rules.Point
+		}{{rules.Black, action.Black}, {rules.White, action.White}} {
+			for _, p := range stones.points {
+				if cleared.At(p.X, p.Y) != rules.Empty {
+					return nil, fmt.Errorf("point %d,%d is set up twice", p.X, p.Y)
+				}
+				if err := cleared.Place(stones.color, p.X, p.Y); err != nil {
+					return nil, fmt.Errorf("setup stone %d,%d: %w", p.X, p.Y, err)
+				}
+			}
+		}
+		if color != rules.Empty {
+			cleared.SetNext(color)
+		}
+		return cleared, nil
+	default:
+		return nil, fmt.Errorf("unknown action type %q", action.Type)
+	}
+	return board, nil
+}
+
+// replayDemo returns the position after actions.
+func replayDemo(demo models.DemoBoard, actions []models.DemoAction) (*rules.Board, error) {
+	board := rules.NewBoard(demo.BoardSize)
+	for _, a := range actions {
+		var err error
+		if board, err = applyDemoAction(board, a); err != nil {
+			return nil, fmt.Errorf("demo #%d action %d: %w", demo.ID, a.Seq, err)
+		}
+	}
+	return board, nil
+}
+
+// demoState describes the position after actions. Stored actions were
+// checked when they were added, so replaying them cannot fail unless the
+// rules changed; the position is then left where it stopped.
+func demoState(demo models.DemoBoard, actions []models.DemoAction) models.DemoStateData {
+	board := rules.NewBoard(demo.BoardSize)
+	state := models.DemoStateData{Demo: demo}
+	for _, a := range actions {
+		next, err := applyDemoAction(board, a)
+		if err != nil {
+			log.Printf("Demo #%d action %d: %v, skipping", demo.ID, a.Seq, err)
+			continue
+		}
+		board = next
+		state.LastMove = nil
+		if a.Type == models.DemoPlay {
+			state.LastMove = &rules.Point{X: a.X, Y: a.Y}
+		}
+	}
+	if len(actions) > 0 {
+		state.Seq = actions[len(actions)-1].Seq
+	}
+	state.Board = board.Grid()
+	state.Captures = boardCaptures(board)
+	state.ToMove = board.Next().String()
+	return state
+}
+
+// SetDemoPresenter lets another player change a demo board. Owner only.
+func (h *Handler) SetDemoPresenter(w http.ResponseWriter, r *http.Request) {
+	h.changePresenters(w, r, "INSERT INTO demo_presenters (demo_id, player_id) VALUES ($1, $2) ON CONFLICT DO NOTHING")
+}
+
+// RemoveDemoPresenter stops a player from changing a demo board. Owner only.
+func (h *Handler) RemoveDemoPresenter(w http.ResponseWriter, r *http.Request) {
+	h.changePresenters(w, r, "DELETE FROM demo_presenters WHERE demo_id = $1 AND player_id = $2")
+}
+
+// changePresenters runs query with the demo and player IDs in the URL on
+// behalf of the demo's owner, then answers with the demo's new state.
+func (h *Handler) changePresenters(w http.ResponseWriter, r *http.Request, query string) {
+	playerID, ok := middleware.GetPlayerID(r)
+	if !ok {
+		http.Error(w, "Unauthorized: Player ID not found", http.StatusUnauthorized)
+		return
+	}
+	demoID, ok := demoIDParam(w, r)
+	if !ok {
+		return
+	}
+	presenterID, err := strconv.Atoi(chi.URLParam(r, "playerID"))
+	if err != nil {
+		http.Error(w, "Invalid player ID", http.StatusBadRequest)
+		return
+	}
+
+	state, err := h.changeDemo(demoID, playerID, func(tx *sql.Tx, demo models.DemoBoard, actions []models.DemoAction) ([]models.DemoAction, error) {
+		if demo.OwnerID != playerID {
+			return nil, &demoError{http.StatusForbidden, "Only the owner can change presenters"}
+		}
+		_, err := tx.Exec(query, demo.ID, presenterID)
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23503" { // foreign_key_violation
+			return nil, &demoError{http.StatusNotFound, "Player not found"}
+		}
+		return actions, err
+	})
+	if err != nil {
+		writeDemoError(w, err)
+		return
+	}
+	respondDemoState(w, http.StatusOK, state)
+}
+
+// changeDemo applies change to a demo board inside a transaction that
+// locks it, then tells everyone following the board about its new state.
+// Only presenters may change a board. change returns the board's actions
+// after the change.
+func (h *Handler) changeDemo(demoID, playerID int, change func(tx *sql.Tx, demo models.DemoBoard, actions []models.DemoAction) ([]models.DemoAction, error)) (models.DemoStateData, error) {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return models.DemoStateData{}, err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			log.Printf("Failed to roll back demo change: %v", err)
+		}
+	}()
+
+	demo, err := queryDemo(tx, "SELECT id, owner_id, title, board_size, created_at, updated_at FROM demo_boards WHERE id = $1 FOR UPDATE", demoID)
+	if err == sql.ErrNoRows {
+		return models.DemoStateData{}, &demoError{http.StatusNotFound, "Demo board not found"}
+	}
+	if err != nil {
+		return models.DemoStateData{}, err
+	}
+	if demo.OwnerID != playerID && !slices.Contains(demo.Presenters, playerID) {
+		return models.DemoStateData{}, &demoError{http.StatusForbidden, "Only presenters can change a demo board"}
+	}
+
+	actions, err := queryDemoActions(tx, demoID)
+	if err != nil {
+		return models.DemoStateData{}, err
+	}
+	if actions, err = change(tx, demo, actions); err != nil {
+		return models.DemoStateData{}, err
+	}
+
+	err = tx.QueryRow("UPDATE demo_boards SET updated_at = CURRENT_TIMESTAMP WHERE id = $1 RETURNING updated_at", demoID).Scan(&demo.UpdatedAt)
+	if err != nil {
+		return models.DemoStateData{}, err
+	}
+	if demo.Presenters, err = queryDemoPresenters(tx, demoID); err != nil {
+		return models.DemoStateData{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return models.DemoStateData{}, err
+	}
+
+	state := demoState(demo, actions)
+	if message, err := encodeMessage(models.MsgDemoState, state); err != nil {
+		log.Printf("Failed to marshal %s message: %v", models.MsgDemoState, err)
+	} else {
+		hub.Broadcast(demoChannel(demoID), message)
+	}
+	return state, nil
+}
+
+func respondDemoState(w http.ResponseWriter, status int, state models.DemoStateData) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(state); err != nil {
+		log.Printf("Failed to encode demo response: %v", err)
+	}
+}
+
+// demoIDParam parses the demo ID in the URL, answering 400 if it is not a
+// number.
+func demoIDParam(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "demoID"))
+	if err != nil {
+		http.Error(w, "Invalid demo ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// loadDemo loads the demo board named in the URL with its actions,
+// answering the request itself if that fails.
+func (h *Handler) loadDemo(w http.ResponseWriter, r *http.Request) (models.DemoBoard, []models.DemoAction, bool) {
+	id, ok := demoIDParam(w, r)
+	if !ok {
+		return models.DemoBoard{}, nil, false
+	}
+
+	demo, actions, err := h.getDemo(id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Demo board not found", http.StatusNotFound)
+		return models.DemoBoard{}, nil, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return models.DemoBoard{}, nil, false
+	}
+	return demo, actions, true
+}
+
+// getDemo loads a demo board with its actions.
+func (h *Handler) getDemo(id int) (models.DemoBoard, []models.DemoAction, error) {
+	demo, err := queryDemo(h.db, "SELECT id, owner_id, title, board_size, created_at, updated_at FROM demo_boards WHERE id = $1", id)
+	if err != nil {
+		return models.DemoBoard{}, nil, err
+	}
+	actions, err := queryDemoActions(h.db, id)
+	return demo, actions, err
+}
+
+// queryDemo loads a demo board and its presenters.
+func queryDemo(q querier, query string, id int) (models.DemoBoard, error) {
+	var demo models.DemoBoard
+	err := q.QueryRow(query, id).Scan(&demo.ID, &demo.OwnerID, &demo.Title, &demo.BoardSize, &demo.CreatedAt, &demo.UpdatedAt)
+	if err != nil {
+		return models.DemoBoard{}, err
+	}
+	demo.Presenters, err = queryDemoPresenters(q, id)
+	return demo, err
+}
+
+func scanDemo(rows *sql.Rows) (models.DemoBoard, error) {
+	var demo models.DemoBoard
+	var presenters pq.Int64Array
+	err := rows.Scan(&demo.ID, &demo.OwnerID, &demo.Title, &demo.BoardSize, &demo.CreatedAt, &demo.UpdatedAt, &presenters)
+	if err != nil {
+		return models.DemoBoard{}, err
+	}
+	demo.Presenters = make([]int, len(presenters))
+	for i, id := range presenters {
+		demo.Presenters[i] = int(id)
+	}
+	return demo, nil
+}
+
+func queryDemoPresenters(q querier, demoID int) ([]int, error) {
+	rows, err := q.Query("SELECT player_id FROM demo_presenters WHERE demo_id = $1 ORDER BY player_id", demoID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Failed to close rows: %v", err)
+		}
+	}()
+
+	presenters := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		presenters = append(presenters, id)
+	}
+	return presenters, rows.Err()
+}
+
+// queryDemoActions loads the actions of a demo board in order.
+func queryDemoActions(q querier, demoID int) ([]models.DemoAction, error) {
+	rows, err := q.Query("SELECT seq, type, color, x, y, black, white, created_at FROM demo_actions WHERE demo_id = $1 ORDER BY seq", demoID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Failed to close rows: %v", err)
+		}
+	}()
+
+	var actions []models.DemoAction
+	for rows.Next() {
+		var a models.DemoAction
+		var black, white []byte
+		if err := rows.Scan(&a.Seq, &a.Type, &a.Color, &a.X, &a.Y, &black, &white, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(black, &a.Black); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(white, &a.White); err != nil {
+			return nil, err
+		}
+		actions = append(actions, a)
+	}
+	return actions, rows.Err()
+}
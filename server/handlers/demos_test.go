@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+
+	"frogs_cafe/models"
+	"frogs_cafe/rules"
+)
+
+func TestDemoState(t *testing.T) {
+	demo := models.DemoBoard{ID: 1, BoardSize: 3}
+	setup := []models.DemoAction{
+		{Seq: 1, Type: models.DemoPlace, Color: "white", X: 0, Y: 0},
+		{Seq: 2, Type: models.DemoPlace, Color: "black", X: 0, Y: 1},
+		{Seq: 3, Type: models.DemoPlay, Color: "black", X: 1, Y: 0},
+	}
+
+	tests := []struct {
+		name     string
+		actions  []models.DemoAction
+		seq      int
+		board    [][]string
+		captures models.Captures
+		toMove   string
+		lastMove *rules.Point
+	}{
+		{
+			name:   "empty board",
+			board:  [][]string{{"", "", ""}, {"", "", ""}, {"", "", ""}},
+			toMove: "black",
+		},
+		{
+			name:     "play captures",
+			actions:  setup,
+			seq:      3,
+			board:    [][]string{{"", "black", ""}, {"black", "", ""}, {"", "", ""}},
+			captures: models.Captures{Black: 1},
+			toMove:   "white",
+			lastMove: &rules.Point{X: 1, Y: 0},
+		},
+		{
+			name:     "removal clears the last move",
+			actions:  append(setup[:3:3], models.DemoAction{Seq: 4, Type: models.DemoRemove, X: 0, Y: 1}),
+			seq:      4,
+			board:    [][]string{{"", "black", ""}, {"", "", ""}, {"", "", ""}},
+			captures: models.Captures{Black: 1},
+			toMove:   "white",
+		},
+		{
+			name:     "broken stored action is skipped",
+			actions:  append(setup[:3:3], models.DemoAction{Seq: 4, Type: models.DemoRemove, X: 2, Y: 2}),
+			seq:      4,
+			board:    [][]string{{"", "black", ""}, {"black", "", ""}, {"", "", ""}},
+			captures: models.Captures{Black: 1},
+			toMove:   "white",
+			lastMove: &rules.Point{X: 1, Y: 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := demoState(demo, tt.actions)
+			if state.Seq != tt.seq {
+				t.Errorf("Seq = %d, want %d", state.Seq, tt.seq)
+			}
+			if !reflect.DeepEqual(state.Board, tt.board) {
+				t.Errorf("Board = %v, want %v", state.Board, tt.board)
+			}
+			if state.Captures != tt.captures {
+				t.Errorf("Captures = %+v, want %+v", state.Captures, tt.captures)
+			}
+			if state.ToMove != tt.toMove {
+				t.Errorf("ToMove = %s, want %s", state.ToMove, tt.toMove)
+			}
+			if !reflect.DeepEqual(state.LastMove, tt.lastMove) {
+				t.Errorf("LastMove = %v, want %v", state.LastMove, tt.lastMove)
+			}
+		})
+	}
+}
@@ -0,0 +1,291 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"frogs_cafe/explorer"
+	"frogs_cafe/models"
+	"frogs_cafe/rules"
+	"frogs_cafe/sgf"
+)
+
+// explorerBatchSize is how many games IndexFinishedGames reads at a time.
+const explorerBatchSize = 100
+
+// Explorer returns the moves played after an opening in finished games.
+// board_size defaults to 19; moves is a comma separated list of SGF points
+// played alternately from Black, e.g. moves=pd,dp,pp.
+func (h *Handler) Explorer(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	size := 19
+	if value := params.Get("board_size"); value != "" {
+		var err error
+		size, err = strconv.Atoi(value)
+		if err != nil || size < 2 || size > sgf.MaxBoardSize {
+			http.Error(w, fmt.Sprintf("board_size must be between 2 and %d", sgf.MaxBoardSize), http.StatusBadRequest)
+			return
+		}
+	}
+
+	moves := []rules.Point{}
+	board := rules.NewBoard(size)
+	if value := params.Get("moves"); value != "" {
+		for i, point := range strings.Split(value, ",") {
+			p, err := sgf.ParsePoint(strings.TrimSpace(point), size)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Move %d: %v", i+1, err), http.StatusBadRequest)
+				return
+			}
+			if _, err := board.Play(board.Next(), p.X, p.Y); err != nil {
+				http.Error(w, fmt.Sprintf("Move %d (%s) is illegal: %v", i+1, point, err), http.StatusBadRequest)
+				return
+			}
+			moves = append(moves, p)
+		}
+	}
+
+	data := models.ExplorerData{BoardSize: size, Moves: moves, Continuations: []models.ExplorerMove{}}
+	// Longer sequences are not indexed, so nothing follows them
+	if len(moves) < explorer.MaxDepth {
+		prefix, syms := explorer.Canonical(size, moves)
+		var err error
+		data.Continuations, err = h.queryContinuations(size, prefix, syms[0].Inverse())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	for _, c := range data.Continuations {
+		data.Games += c.Games
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=60")
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		log.Printf("Failed to encode explorer response: %v", err)
+	}
+}
+
+// queryContinuations loads the index entries after prefix, most played
+// first, turning their moves back to the caller's orientation with toCaller.
+func (h *Handler) queryContinuations(size int, prefix string, toCaller explorer.Symmetry) ([]models.ExplorerMove, error) {
+	rows, err := h.db.Query(
+		"SELECT move, games, black_wins, white_wins, rating_total FROM explorer_moves WHERE board_size = $1 AND prefix = $2 ORDER BY games DESC, move",
+		size, prefix,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Failed to close rows: %v", err)
+		}
+	}()
+
+	continuations := []models.ExplorerMove{}
+	for rows.Next() {
+		var move string
+		var c models.ExplorerMove
+		var ratingTotal int64
+		if err := rows.Scan(&move, &c.Games, &c.BlackWins, &c.WhiteWins, &ratingTotal); err != nil {
+			return nil, err
+		}
+		p, err := sgf.ParsePoint(move, size)
+		if err != nil {
+			return nil, err
+		}
+		p = toCaller.Apply(p, size)
+		c.X, c.Y, c.Move = p.X, p.Y, sgf.Point(p.X, p.Y)
+		if c.Games > 0 {
+			c.BlackWinRate = float64(c.BlackWins) / float64(c.Games)
+			c.WhiteWinRate = float64(c.WhiteWins) / float64(c.Games)
+			c.AverageRating = float64(ratingTotal) / float64(2*c.Games)
+		}
+		continuations = append(continuations, c)
+	}
+	return continuations, rows.Err()
+}
+
+// IndexFinishedGames adds every finished game not yet in the opening
+// explorer to its index and returns how many it added. Only new games are
+// read, so it is cheap to run often. A game that fails is logged and left
+// for the next run rather than holding up the games after it.
+//
+// The index is kept up to date by calling this periodically rather than
+// when a game ends: nothing in the server finishes games yet, so they only
+// become finished by other means, and a poll picks them up however that
+// happens.
+func (h *Handler) IndexFinishedGames() (int, error) {
+	count, after := 0, 0
+	for {
+		ids, err := h.unindexedGames(after)
+		if err != nil {
+			return count, err
+		}
+		for _, id := range ids {
+			added, err := h.safeIndexGame(id)
+			if err != nil {
+				log.Printf("Failed to index game %d for the opening explorer: %v", id, err)
+				continue
+			}
+			if added {
+				count++
+			}
+		}
+		if len(ids) < explorerBatchSize {
+			return count, nil
+		}
+		after = ids[len(ids)-1]
+	}
+}
+
+// unindexedGames returns the next batch of finished games after the game
+// with ID after that are not in the index. Boards too large for SGF
+// coordinates cannot be keyed, so they are left out.
+func (h *Handler) unindexedGames(after int) ([]int, error) {
+	rows, err := h.db.Query(
+		`SELECT g.id FROM games g
+		WHERE g.status = 'finished' AND g.id > $1 AND g.board_size BETWEEN 2 AND $2
+			AND NOT EXISTS (SELECT 1 FROM explorer_indexed_games e WHERE e.game_id = g.id)
+		ORDER BY g.id LIMIT $3`,
+		after, sgf.MaxBoardSize, explorerBatchSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Failed to close rows: %v", err)
+		}
+	}()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// safeIndexGame is indexGame for the background indexer, where a panic
+// caused by one bad game would take down the whole server.
+func (h *Handler) safeIndexGame(gameID int) (added bool, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			added, err = false, fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return h.indexGame(gameID)
+}
+
+// indexGame adds a finished game's opening to the explorer index, unless it
+// is there already. It reports whether the game was added. Games with
+// handicap or setup stones are marked as read but not added: the explorer
+// only describes even games from the empty board.
+func (h *Handler) indexGame(gameID int) (bool, error) {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			log.Printf("Failed to roll back explorer index: %v", err)
+		}
+	}()
+
+	game, err := lockGame(tx, gameID)
+	if err != nil {
+		return false, err
+	}
+	if game.Status != "finished" || game.BoardSize < 2 || game.BoardSize > sgf.MaxBoardSize {
+		return false, nil
+	}
+	result, err := tx.Exec("INSERT INTO explorer_indexed_games (game_id) VALUES ($1) ON CONFLICT DO NOTHING", gameID)
+	if err != nil {
+		return false, err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+
+	record, err := h.getGameRecord(gameID)
+	if err != nil {
+		return false, err
+	}
+	if record != nil && (record.Handicap > 0 || len(record.SetupBlack) > 0 || len(record.SetupWhite) > 0) {
+		return false, tx.Commit()
+	}
+
+	moves, err := queryMoves(tx, gameID)
+	if err != nil {
+		return false, err
+	}
+	// The explorer assumes Black and White alternate, so the opening ends at
+	// the first pass or at anything that breaks that order
+	var opening []rules.Point
+	board := rules.NewBoard(game.BoardSize)
+	for _, m := range moves {
+		if len(opening) == explorer.MaxDepth || m.Pass || moveColor(game, m) != board.Next() {
+			break
+		}
+		if !replayMove(board, game, m) {
+			break
+		}
+		opening = append(opening, rules.Point{X: m.X, Y: m.Y})
+	}
+
+	var blackWin, whiteWin int
+	if game.WinnerID != nil {
+		switch playerColor(game, *game.WinnerID) {
+		case rules.Black:
+			blackWin = 1
+		case rules.White:
+			whiteWin = 1
+		}
+	}
+	var ratingTotal int64
+	err = tx.QueryRow(
+		"SELECT COALESCE(SUM(rating), 0) FROM players WHERE id = $1 OR id = $2",
+		game.BlackPlayerID, game.WhitePlayerID,
+	).Scan(&ratingTotal)
+	if err != nil {
+		return false, err
+	}
+
+	stmt, err := tx.Prepare(
+		`INSERT INTO explorer_moves (board_size, prefix, move, games, black_wins, white_wins, rating_total)
+		VALUES ($1, $2, $3, 1, $4, $5, $6)
+		ON CONFLICT (board_size, prefix, move) DO UPDATE SET
+			games = explorer_moves.games + 1,
+			black_wins = explorer_moves.black_wins + EXCLUDED.black_wins,
+			white_wins = explorer_moves.white_wins + EXCLUDED.white_wins,
+			rating_total = explorer_moves.rating_total + EXCLUDED.rating_total`,
+	)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		if err := stmt.Close(); err != nil {
+			log.Printf("Failed to close statement: %v", err)
+		}
+	}()
+	for _, entry := range explorer.Entries(game.BoardSize, opening) {
+		if _, err := stmt.Exec(game.BoardSize, entry.Prefix, entry.Move, blackWin, whiteWin, ratingTotal); err != nil {
+			return false, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
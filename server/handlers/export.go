@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"archive/zip"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"frogs_cafe/models"
+	"frogs_cafe/sgf"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// ExportPlayerGames streams a zip of a player's finished games as SGF
+// files. Optional filters: from and to (YYYY-MM-DD, inclusive, by the day
+// the game was created), opponent (a player ID) and result (win or loss,
+// from the player's side). Games are loaded and written one at a time, so
+// memory use does not grow with the archive. Games that cannot be loaded
+// are left out and named in an ERRORS.txt entry at the end.
+func (h *Handler) ExportPlayerGames(w http.ResponseWriter, r *http.Request) {
+	playerID := chi.URLParam(r, "playerID")
+	id, err := strconv.Atoi(playerID)
+	if err != nil {
+		http.Error(w, "Invalid player ID", http.StatusBadRequest)
+		return
+	}
+
+	query, args, err := exportQuery(id, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var username string
+	err = h.db.QueryRow("SELECT username FROM players WHERE id = $1", id).Scan(&username)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Player not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	gameIDs, err := h.queryIDs(query, args...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("frogs-cafe-%s-games.zip", username)))
+
+	archive := zip.NewWriter(w)
+	defer func() {
+		if err := archive.Close(); err != nil {
+			log.Printf("Failed to finish game archive for player %d: %v", id, err)
+		}
+	}()
+
+	var failed []int
+	for _, gameID := range gameIDs {
+		if r.Context().Err() != nil {
+			// The client went away; stop loading games for nobody
+			return
+		}
+		game, record, err := h.loadGameSGF(gameID)
+		if err != nil {
+			log.Printf("Failed to export game %d for player %d: %v", gameID, id, err)
+			failed = append(failed, gameID)
+			continue
+		}
+		if err := writeZipEntry(archive, sgfFilename(gameID), game.UpdatedAt, func(entry io.Writer) error {
+			return sgf.Encode(entry, record)
+		}); err != nil {
+			// Writing to the response failed, so nothing more can be sent
+			log.Printf("Failed to write game %d for player %d: %v", gameID, id, err)
+			return
+		}
+	}
+
+	if len(failed) > 0 {
+		err := writeZipEntry(archive, "ERRORS.txt", time.Now(), func(entry io.Writer) error {
+			return writeExportErrors(entry, failed)
+		})
+		if err != nil {
+			log.Printf("Failed to write export errors for player %d: %v", id, err)
+		}
+	}
+}
+
+// loadGameSGF loads a game and builds its SGF tree.
+func (h *Handler) loadGameSGF(gameID int) (models.Game, *sgf.Node, error) {
+	game, err := h.getGame(gameID)
+	if err != nil {
+		return models.Game{}, nil, err
+	}
+	record, err := h.gameSGF(game)
+	return game, record, err
+}
+
+// writeZipEntry adds a compressed file to archive, with write supplying its
+// contents.
+func writeZipEntry(archive *zip.Writer, name string, modified time.Time, write func(io.Writer) error) error {
+	entry, err := archive.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: modified,
+	})
+	if err != nil {
+		return err
+	}
+	return write(entry)
+}
+
+// writeExportErrors lists the games an export left out, one file name per
+// line.
+func writeExportErrors(w io.Writer, gameIDs []int) error {
+	if _, err := fmt.Fprintf(w, "%d game(s) could not be exported and are missing from this archive:\n", len(gameIDs)); err != nil {
+		return err
+	}
+	for _, gameID := range gameIDs {
+		if _, err := fmt.Fprintf(w, "%s (game #%d)\n", sgfFilename(gameID), gameID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportQuery builds the query selecting the IDs of a player's finished
+// games that match the request's filters.
+func exportQuery(playerID int, r *http.Request) (string, []interface{}, error) {
+	conditions := []string{"status = 'finished'", "(black_player_id = $1 OR white_player_id = $1)"}
+	args := []interface{}{playerID}
+	addCondition := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	params := r.URL.Query()
+	if from := params.Get("from"); from != "" {
+		day, err := time.Parse("2006-01-02", from)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid from date %q, expected YYYY-MM-DD", from)
+		}
+		addCondition("created_at >= $%d", day)
+	}
+	if to := params.Get("to"); to != "" {
+		day, err := time.Parse("2006-01-02", to)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid to date %q, expected YYYY-MM-DD", to)
+		}
+		addCondition("created_at < $%d", day.AddDate(0, 0, 1))
+	}
+	if opponent := params.Get("opponent"); opponent != "" {
+		opponentID, err := strconv.Atoi(opponent)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid opponent %q", opponent)
+		}
+		addCondition("(black_player_id = $%[1]d OR white_player_id = $%[1]d)", opponentID)
+	}
+	switch result := params.Get("result"); result {
+	case "":
+	case "win":
+		conditions = append(conditions, "winner_id = $1")
+	case "loss":
+		conditions = append(conditions, "winner_id IS NOT NULL AND winner_id <> $1")
+	default:
+		return "", nil, fmt.Errorf("invalid result %q, expected win or loss", result)
+	}
+
+	query := "SELECT id FROM games WHERE " + strings.Join(conditions, " AND ") + " ORDER BY created_at ASC"
+	return query, args, nil
+}
+
+// queryIDs runs a query selecting a single integer column.
+func (h *Handler) queryIDs(query string, args ...interface{}) ([]int, error) {
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Failed to close rows: %v", err)
+		}
+	}()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportErrorsEntry(t *testing.T) {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	err := writeZipEntry(archive, "ERRORS.txt", time.Now(), func(entry io.Writer) error {
+		return writeExportErrors(entry, []int{4, 17})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reader.File) != 1 || reader.File[0].Name != "ERRORS.txt" {
+		t.Fatalf("archive holds %v, want ERRORS.txt", reader.File)
+	}
+	f, err := reader.File[0].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	contents, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "2 game(s) could not be exported and are missing from this archive:\n" +
+		"frogs-cafe-4.sgf (game #4)\n" +
+		"frogs-cafe-17.sgf (game #17)\n"
+	if string(contents) != want {
+		t.Errorf("ERRORS.txt = %q, want %q", contents, want)
+	}
+}
+
+func TestExportQuery(t *testing.T) {
+	tests := []struct {
+		name       string
+		params     string
+		conditions []string
+		args       []interface{}
+		err        bool
+	}{
+		{
+			name:   "no filters",
+			params: "",
+			args:   []interface{}{7},
+		},
+		{
+			name:       "date range",
+			params:     "from=2024-01-01&to=2024-01-31",
+			conditions: []string{"created_at >= $2", "created_at < $3"},
+			args:       []interface{}{7, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			name:       "opponent and losses",
+			params:     "opponent=9&result=loss",
+			conditions: []string{"(black_player_id = $2 OR white_player_id = $2)", "winner_id IS NOT NULL AND winner_id <> $1"},
+			args:       []interface{}{7, 9},
+		},
+		{name: "bad date", params: "from=01/01/2024", err: true},
+		{name: "bad opponent", params: "opponent=bob", err: true},
+		{name: "bad result", params: "result=draw", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/export?"+tt.params, nil)
+			query, args, err := exportQuery(7, r)
+			if (err != nil) != tt.err {
+				t.Fatalf("exportQuery() error = %v, want error %v", err, tt.err)
+			}
+			if tt.err {
+				return
+			}
+			for _, condition := range append([]string{"status = 'finished'"}, tt.conditions...) {
+				if !strings.Contains(query, condition) {
+					t.Errorf("query %q lacks %q", query, condition)
+				}
+			}
+			if !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("args = %v, want %v", args, tt.args)
+			}
+		})
+	}
+}
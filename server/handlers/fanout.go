@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+)
+
+// busEvent is the form in which channel broadcasts travel between server
+// instances. Game events carry their payload undecorated so each instance
+// can stamp its own sequence number; everything else is pre-encoded. Origin
+// is the publishing hub's epoch, which is unique to each running instance.
+type busEvent struct {
+	Origin  string          `json:"origin"`
+	Channel string          `json:"channel"`
+	GameID  int             `json:"game_id,omitempty"`
+	Type    string          `json:"type,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"`
+	Message json.RawMessage `json:"message,omitempty"`
+}
+
+// publishEvent delivers event to this instance's clients, then hands it to
+// the pub/sub backend for every other instance. Local clients never depend
+// on the bus, so they get the event even when publishing fails.
+func (h *Hub) publishEvent(event busEvent) {
+	h.broadcast <- event.envelope()
+
+	event.Origin = h.epoch
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Failed to encode %s event: %v", event.Channel, err)
+		return
+	}
+	if err := h.bus.Publish(event.Channel, payload); err != nil {
+		log.Printf("Failed to publish %s event: %v", event.Channel, err)
+	}
+}
+
+// receive queues events published on other instances for local delivery.
+// An event the bus lost is made up for by resynchronising its channel.
+func (h *Hub) receive() {
+	for msg := range h.bus.Messages() {
+		if msg.Payload == nil {
+			h.resyncs <- msg.Channel
+			continue
+		}
+		var event busEvent
+		if err := json.Unmarshal(msg.Payload, &event); err != nil {
+			log.Printf("Ignoring malformed pub/sub event: %v", err)
+			continue
+		}
+		// This instance delivered its own events when publishing them
+		if event.Origin == h.epoch {
+			continue
+		}
+		h.broadcast <- event.envelope()
+	}
+}
+
+// envelope addresses event to its channel on this instance.
+func (event busEvent) envelope() envelope {
+	env := envelope{channel: event.Channel, message: event.Message}
+	if event.GameID != 0 {
+		env.gameID = event.GameID
+		env.msgType = event.Type
+		env.data = event.Data
+	}
+	return env
+}
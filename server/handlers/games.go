@@ -3,43 +3,19 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"strconv"
+	"time"
 
 	"frogs_cafe/middleware"
 	"frogs_cafe/models"
+	"frogs_cafe/sgf"
 
 	"github.com/go-chi/chi/v5"
 )
 
-func (h *Handler) SaveMove(gameIDStr string, playerID int, data map[string]interface{}) error {
-	gameID, err := strconv.Atoi(gameIDStr)
-	if err != nil {
-		return err
-	}
-
-	x := int(data["x"].(float64))
-	y := int(data["y"].(float64))
-
-	// Get the current move number
-	var moveNumber int
-	err = h.db.QueryRow(
-		"SELECT COALESCE(MAX(move_number), 0) + 1 FROM moves WHERE game_id = $1",
-		gameID,
-	).Scan(&moveNumber)
-	if err != nil {
-		return err
-	}
-
-	// Insert the move
-	_, err = h.db.Exec(
-		"INSERT INTO moves (game_id, player_id, move_number, x, y) VALUES ($1, $2, $3, $4, $5)",
-		gameID, playerID, moveNumber, x, y,
-	)
-	return err
-}
-
 func (h *Handler) ListGames(w http.ResponseWriter, r *http.Request) {
 	// Support filtering by status query parameter
 	status := r.URL.Query().Get("status")
@@ -98,6 +74,10 @@ func (h *Handler) CreateGame(w http.ResponseWriter, r *http.Request) {
 	if req.BoardSize == 0 {
 		req.BoardSize = 19
 	}
+	if req.BoardSize < 2 || req.BoardSize > sgf.MaxBoardSize {
+		http.Error(w, fmt.Sprintf("Board size must be between 2 and %d", sgf.MaxBoardSize), http.StatusBadRequest)
+		return
+	}
 
 	// Create game without assigning colors yet - colors will be assigned when someone joins
 	// Store creator_id temporarily to track who created the game
@@ -112,6 +92,8 @@ func (h *Handler) CreateGame(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	notifyLobby(models.LobbyGameCreated, game)
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	if err := json.NewEncoder(w).Encode(game); err != nil {
@@ -204,12 +186,18 @@ func (h *Handler) JoinGame(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Update game with both players and set status to active
+	// Update game with both players and set status to active. The status
+	// check is repeated here so a game cancelled or joined since it was read
+	// above stays as it is.
 	err = h.db.QueryRow(
-		"UPDATE games SET black_player_id = $1, white_player_id = $2, status = 'active', updated_at = CURRENT_TIMESTAMP WHERE id = $3 RETURNING id, black_player_id, white_player_id, board_size, status, winner_id, creator_id, created_at, updated_at",
+		"UPDATE games SET black_player_id = $1, white_player_id = $2, status = 'active', updated_at = CURRENT_TIMESTAMP WHERE id = $3 AND status = 'waiting' RETURNING id, black_player_id, white_player_id, board_size, status, winner_id, creator_id, created_at, updated_at",
 		blackPlayerID, whitePlayerID, id,
 	).Scan(&game.ID, &game.BlackPlayerID, &game.WhitePlayerID, &game.BoardSize, &game.Status, &game.WinnerID, &game.CreatorID, &game.CreatedAt, &game.UpdatedAt)
 
+	if err == sql.ErrNoRows {
+		http.Error(w, "Game is no longer available to join", http.StatusConflict)
+		return
+	}
 	if err != nil {
 		log.Printf("Failed to update game status: %v", err)
 		http.Error(w, "Failed to join game", http.StatusInternalServerError)
@@ -220,24 +208,11 @@ func (h *Handler) JoinGame(w http.ResponseWriter, r *http.Request) {
 
 	// Broadcast game status update via WebSocket
 	if hub := GetHub(); hub != nil {
-		gameUpdate := map[string]interface{}{
-			"type": "game_update",
-			"data": map[string]interface{}{
-				"game_id":         game.ID,
-				"status":          game.Status,
-				"black_player_id": game.BlackPlayerID,
-				"white_player_id": game.WhitePlayerID,
-				"game":            game,
-			},
-		}
-		if updateBytes, err := json.Marshal(gameUpdate); err == nil {
-			hub.broadcast <- updateBytes
-		} else {
-			log.Printf("Failed to marshal game_update message: %v", err)
-		}
+		hub.PublishGameEvent(game.ID, models.MsgGameUpdate, newGameUpdateData(game))
 	} else {
 		log.Printf("Warning: WebSocket hub not initialized, skipping broadcast")
 	}
+	notifyLobby(models.LobbyGameStarted, game)
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(game); err != nil {
@@ -245,7 +220,14 @@ func (h *Handler) JoinGame(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (h *Handler) GetGame(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) CancelGame(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated player ID from context
+	playerID, ok := middleware.GetPlayerID(r)
+	if !ok {
+		http.Error(w, "Unauthorized: Player ID not found", http.StatusUnauthorized)
+		return
+	}
+
 	gameID := chi.URLParam(r, "gameID")
 	id, err := strconv.Atoi(gameID)
 	if err != nil {
@@ -268,6 +250,131 @@ func (h *Handler) GetGame(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if game.CreatorID == nil || *game.CreatorID != playerID {
+		http.Error(w, "Only the creator can cancel this game", http.StatusForbidden)
+		return
+	}
+
+	if game.Status != "waiting" {
+		http.Error(w, "Only waiting games can be cancelled", http.StatusConflict)
+		return
+	}
+
+	// Re-check the status in the update so a concurrent join wins cleanly
+	err = h.db.QueryRow(
+		"UPDATE games SET status = 'cancelled', updated_at = CURRENT_TIMESTAMP WHERE id = $1 AND status = 'waiting' RETURNING id, black_player_id, white_player_id, board_size, status, winner_id, creator_id, created_at, updated_at",
+		id,
+	).Scan(&game.ID, &game.BlackPlayerID, &game.WhitePlayerID, &game.BoardSize, &game.Status, &game.WinnerID, &game.CreatorID, &game.CreatedAt, &game.UpdatedAt)
+
+	if err == sql.ErrNoRows {
+		http.Error(w, "Only waiting games can be cancelled", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to cancel game: %v", err)
+		http.Error(w, "Failed to cancel game", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Game #%d cancelled by creator (Player #%d)", game.ID, playerID)
+	notifyGameCancelled(game)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(game); err != nil {
+		log.Printf("Failed to encode game response: %v", err)
+	}
+}
+
+// CancelStaleGames cancels every game that has been waiting for an opponent
+// longer than maxAge and returns how many were cancelled.
+func (h *Handler) CancelStaleGames(maxAge time.Duration) (int, error) {
+	rows, err := h.db.Query(
+		"UPDATE games SET status = 'cancelled', updated_at = CURRENT_TIMESTAMP WHERE status = 'waiting' AND created_at < CURRENT_TIMESTAMP - make_interval(secs => $1) RETURNING id, black_player_id, white_player_id, board_size, status, winner_id, creator_id, created_at, updated_at",
+		maxAge.Seconds(),
+	)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Failed to close rows: %v", err)
+		}
+	}()
+
+	var cancelled []models.Game
+	for rows.Next() {
+		var g models.Game
+		if err := rows.Scan(&g.ID, &g.BlackPlayerID, &g.WhitePlayerID, &g.BoardSize, &g.Status, &g.WinnerID, &g.CreatorID, &g.CreatedAt, &g.UpdatedAt); err != nil {
+			return 0, err
+		}
+		cancelled = append(cancelled, g)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, g := range cancelled {
+		log.Printf("Game #%d cancelled after waiting longer than %s", g.ID, maxAge)
+		notifyGameCancelled(g)
+	}
+
+	return len(cancelled), nil
+}
+
+// notifyGameCancelled tells the game's watchers and the lobby that a waiting
+// game has been removed.
+func notifyGameCancelled(game models.Game) {
+	if hub := GetHub(); hub != nil {
+		hub.PublishGameEvent(game.ID, models.LobbyGameCancelled, newGameUpdateData(game))
+	}
+	notifyLobby(models.LobbyGameCancelled, game)
+}
+
+// notifyLobby sends a game event to every client subscribed to the lobby.
+func notifyLobby(eventType string, game models.Game) {
+	hub := GetHub()
+	if hub == nil {
+		log.Printf("Warning: WebSocket hub not initialized, skipping lobby broadcast")
+		return
+	}
+
+	messageBytes, err := encodeMessage(eventType, newGameUpdateData(game))
+	if err != nil {
+		log.Printf("Failed to marshal %s message: %v", eventType, err)
+		return
+	}
+
+	hub.Broadcast(lobbyChannel, messageBytes)
+}
+
+func newGameUpdateData(game models.Game) models.GameUpdateData {
+	return models.GameUpdateData{
+		GameID:        game.ID,
+		Status:        game.Status,
+		BlackPlayerID: game.BlackPlayerID,
+		WhitePlayerID: game.WhitePlayerID,
+		Game:          &game,
+	}
+}
+
+func (h *Handler) GetGame(w http.ResponseWriter, r *http.Request) {
+	gameID := chi.URLParam(r, "gameID")
+	id, err := strconv.Atoi(gameID)
+	if err != nil {
+		http.Error(w, "Invalid game ID", http.StatusBadRequest)
+		return
+	}
+
+	game, err := h.getGame(id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Game not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(game); err != nil {
 		log.Printf("Failed to encode game response: %v", err)
@@ -282,14 +389,65 @@ func (h *Handler) GetGameMoves(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	rows, err := h.db.Query(
-		"SELECT id, game_id, player_id, move_number, x, y, created_at FROM moves WHERE game_id = $1 ORDER BY move_number ASC",
-		id,
-	)
+	moves, err := h.getMoves(id)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+
+	// Comments and markup are left out unless asked for
+	if r.URL.Query().Get("annotations") == "true" {
+		annotations, err := h.getAnnotations(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		attachAnnotations(moves, annotations)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(moves); err != nil {
+		log.Printf("Failed to encode moves response: %v", err)
+	}
+}
+
+// querier is implemented by both *sql.DB and *sql.Tx, so loaders can run
+// inside or outside a transaction.
+type querier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// getGame loads a single game, returning sql.ErrNoRows if it does not exist.
+func (h *Handler) getGame(id int) (models.Game, error) {
+	return queryGame(h.db, "SELECT id, black_player_id, white_player_id, board_size, status, winner_id, creator_id, created_at, updated_at FROM games WHERE id = $1", id)
+}
+
+// lockGame loads a game inside tx and locks its row until tx ends, so
+// writers to the same game take turns.
+func lockGame(tx *sql.Tx, id int) (models.Game, error) {
+	return queryGame(tx, "SELECT id, black_player_id, white_player_id, board_size, status, winner_id, creator_id, created_at, updated_at FROM games WHERE id = $1 FOR UPDATE", id)
+}
+
+func queryGame(q querier, query string, id int) (models.Game, error) {
+	var game models.Game
+	err := q.QueryRow(query, id).Scan(&game.ID, &game.BlackPlayerID, &game.WhitePlayerID, &game.BoardSize, &game.Status, &game.WinnerID, &game.CreatorID, &game.CreatedAt, &game.UpdatedAt)
+	return game, err
+}
+
+// getMoves loads the moves of a game in order.
+func (h *Handler) getMoves(gameID int) ([]models.Move, error) {
+	return queryMoves(h.db, gameID)
+}
+
+func queryMoves(q querier, gameID int) ([]models.Move, error) {
+	rows, err := q.Query(
+		"SELECT id, game_id, COALESCE(player_id, 0), move_number, x, y, COALESCE(color, ''), is_pass, created_at FROM moves WHERE game_id = $1 ORDER BY move_number ASC",
+		gameID,
+	)
+	if err != nil {
+		return nil, err
+	}
 	defer func() {
 		if err := rows.Close(); err != nil {
 			log.Printf("Failed to close rows: %v", err)
@@ -300,15 +458,10 @@ func (h *Handler) GetGameMoves(w http.ResponseWriter, r *http.Request) {
 	moves := []models.Move{}
 	for rows.Next() {
 		var m models.Move
-		if err := rows.Scan(&m.ID, &m.GameID, &m.PlayerID, &m.MoveNumber, &m.X, &m.Y, &m.CreatedAt); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+		if err := rows.Scan(&m.ID, &m.GameID, &m.PlayerID, &m.MoveNumber, &m.X, &m.Y, &m.Color, &m.Pass, &m.CreatedAt); err != nil {
+			return nil, err
 		}
 		moves = append(moves, m)
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(moves); err != nil {
-		log.Printf("Failed to encode moves response: %v", err)
-	}
+	return moves, rows.Err()
 }
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"log"
+
+	"frogs_cafe/models"
+	"frogs_cafe/rules"
+)
+
+// loadGameState builds a snapshot of a game from the database and the rules
+// engine. The caller fills in the sequence number and spectator count.
+func (h *Handler) loadGameState(gameID int) (*models.GameStateData, error) {
+	game, err := h.getGame(gameID)
+	if err != nil {
+		return nil, err
+	}
+
+	moves, err := h.getMoves(gameID)
+	if err != nil {
+		return nil, err
+	}
+
+	record, err := h.getGameRecord(gameID)
+	if err != nil {
+		return nil, err
+	}
+
+	board := replayGame(game, record, moves)
+	state := &models.GameStateData{
+		GameID:   gameID,
+		Game:     game,
+		Moves:    moves,
+		Record:   record,
+		Board:    board.Grid(),
+		Captures: boardCaptures(board),
+		ToMove:   board.Next().String(),
+	}
+	if ko, ok := board.Ko(); ok {
+		state.Ko = &ko
+	}
+	return state, nil
+}
+
+// boardCaptures returns the stones each player has captured on board.
+func boardCaptures(board *rules.Board) models.Captures {
+	return models.Captures{
+		Black: board.Captures(rules.Black),
+		White: board.Captures(rules.White),
+	}
+}
+
+// playerColor returns the color playerID plays in game, or rules.Empty if
+// they are not one of its players.
+func playerColor(game models.Game, playerID int) rules.Color {
+	switch {
+	case game.BlackPlayerID != nil && *game.BlackPlayerID == playerID:
+		return rules.Black
+	case game.WhitePlayerID != nil && *game.WhitePlayerID == playerID:
+		return rules.White
+	default:
+		return rules.Empty
+	}
+}
+
+// moveColor returns the color that played m: as stored with the move, or
+// for older moves, the color of the player who made it.
+func moveColor(game models.Game, m models.Move) rules.Color {
+	if color := rules.ParseColor(m.Color); color != rules.Empty {
+		return color
+	}
+	return playerColor(game, m.PlayerID)
+}
+
+// replayGame plays a game's stored moves on a fresh board, after the setup
+// stones of record if it was imported. Moves that the rules reject, which
+// older games saved before moves were validated may contain, are skipped.
+func replayGame(game models.Game, record *models.GameRecord, moves []models.Move) *rules.Board {
+	board := rules.NewBoard(game.BoardSize)
+	if record != nil {
+		setupBoard(board, record)
+	}
+	for _, m := range moves {
+		replayMove(board, game, m)
+	}
+	return board
+}
+
+// replayMove plays one stored move on board, logging and skipping it if the
+// rules reject it. It reports whether the move was played.
+func replayMove(board *rules.Board, game models.Game, m models.Move) bool {
+	color := moveColor(game, m)
+	if color == rules.Empty {
+		log.Printf("Game #%d move %d: player %d is not in this game, skipping", game.ID, m.MoveNumber, m.PlayerID)
+		return false
+	}
+	// Turn order was not enforced for older games, so follow the stored colors
+	board.SetNext(color)
+	var err error
+	if m.Pass {
+		err = board.Pass(color)
+	} else {
+		_, err = board.Play(color, m.X, m.Y)
+	}
+	if err != nil {
+		log.Printf("Game #%d move %d: %v, skipping", game.ID, m.MoveNumber, err)
+		return false
+	}
+	return true
+}
+
+// setupBoard places the setup stones of record and sets who plays first:
+// as the file says, otherwise white after handicap stones and black if not.
+func setupBoard(board *rules.Board, record *models.GameRecord) {
+	for _, p := range record.SetupBlack {
+		if err := board.Place(rules.Black, p.X, p.Y); err != nil {
+			log.Printf("Game #%d setup stone %v: %v, skipping", record.GameID, p, err)
+		}
+	}
+	for _, p := range record.SetupWhite {
+		if err := board.Place(rules.White, p.X, p.Y); err != nil {
+			log.Printf("Game #%d setup stone %v: %v, skipping", record.GameID, p, err)
+		}
+	}
+
+	switch {
+	case record.FirstPlayer != "":
+		board.SetNext(rules.ParseColor(record.FirstPlayer))
+	case record.Handicap > 1 && len(record.SetupWhite) == 0:
+		board.SetNext(rules.White)
+	}
+}
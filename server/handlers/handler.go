@@ -1,15 +1,21 @@
 package handlers
 
 import (
+	"frogs_cafe/config"
 	"frogs_cafe/database"
+	"frogs_cafe/pubsub"
+
+	"github.com/gorilla/websocket"
 )
 
 type Handler struct {
-	db *database.DB
+	db       *database.DB
+	cfg      *config.Config
+	upgrader *websocket.Upgrader
 }
 
-func New(db *database.DB) *Handler {
-	h := &Handler{db: db}
-	InitHub(h)
+func New(db *database.DB, cfg *config.Config, bus pubsub.PubSub) *Handler {
+	h := &Handler{db: db, cfg: cfg, upgrader: newUpgrader(cfg)}
+	InitHub(h, bus)
 	return h
 }
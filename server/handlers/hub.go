@@ -0,0 +1,340 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"frogs_cafe/models"
+	"frogs_cafe/pubsub"
+
+	"github.com/gorilla/websocket"
+)
+
+// lobbyChannel carries game created/started/cancelled events.
+const lobbyChannel = "lobby"
+
+// maxSubscriptions caps how many channels a single connection may follow.
+const maxSubscriptions = 50
+
+// gameChannel returns the hub channel for a game's events.
+func gameChannel(gameID int) string {
+	return "game:" + strconv.Itoa(gameID)
+}
+
+// splitChannel splits a channel such as "game:12" into its kind and ID.
+func splitChannel(channel string) (string, int, bool) {
+	kind, value, ok := strings.Cut(channel, ":")
+	if !ok {
+		return "", 0, false
+	}
+	id, err := strconv.Atoi(value)
+	return kind, id, err == nil
+}
+
+// reviewChannel returns the hub channel that follows a review.
+func reviewChannel(reviewID int) string {
+	return "review:" + strconv.Itoa(reviewID)
+}
+
+// demoChannel returns the hub channel that follows a demo board.
+func demoChannel(demoID int) string {
+	return "demo:" + strconv.Itoa(demoID)
+}
+
+// envelope is a message addressed to a single channel or a single client.
+// Senders name the target so the hub never has to decode what it delivers.
+// Game events (gameID set) are encoded by the hub once their sequence number
+// is assigned; everything else arrives pre-encoded in message.
+type envelope struct {
+	channel string
+	client  *Client
+	message []byte
+
+	gameID  int
+	msgType string
+	data    interface{}
+}
+
+// subscription asks the hub to add or remove a client from a channel.
+type subscription struct {
+	client  *Client
+	channel string
+}
+
+// Hub routes messages to the clients subscribed to each channel. Channel
+// broadcasts go out through bus so that clients on every instance receive
+// them; direct sends stay local. Only the run goroutine touches clients,
+// channels, logs and each client's channels and pending, so none of them
+// need a lock.
+type Hub struct {
+	clients     map[*Client]bool
+	channels    map[string]map[*Client]bool
+	logs        map[int]*gameLog // Recent events per game, for resume
+	epoch       string           // Identifies this run's sequence numbers
+	broadcast   chan envelope
+	register    chan *Client
+	unregister  chan *Client
+	subscribe   chan subscription
+	unsubscribe chan subscription
+	resume      chan resumeRequest
+	states      chan stateResult
+	resyncs     chan string // Channels whose subscribers missed an event
+	limiter     *rateLimiter
+	bus         pubsub.PubSub
+	handler     *Handler
+}
+
+var hub *Hub
+
+func InitHub(h *Handler, bus pubsub.PubSub) {
+	hub = &Hub{
+		clients:     make(map[*Client]bool),
+		channels:    make(map[string]map[*Client]bool),
+		logs:        make(map[int]*gameLog),
+		epoch:       newEpoch(),
+		broadcast:   make(chan envelope, 256),
+		register:    make(chan *Client),
+		unregister:  make(chan *Client),
+		subscribe:   make(chan subscription),
+		unsubscribe: make(chan subscription),
+		resume:      make(chan resumeRequest),
+		states:      make(chan stateResult),
+		resyncs:     make(chan string),
+		limiter:     newRateLimiter(h.cfg),
+		bus:         bus,
+		handler:     h,
+	}
+	go hub.run()
+	go hub.receive()
+	go hub.limiter.pruneLoop()
+}
+
+func GetHub() *Hub {
+	return hub
+}
+
+// Broadcast publishes message to every client subscribed to channel, on
+// any instance.
+func (h *Hub) Broadcast(channel string, message []byte) {
+	h.publishEvent(busEvent{Channel: channel, Message: message})
+}
+
+// PublishGameEvent publishes an event for everyone following gameID. Each
+// hub stamps it with the game's next sequence number and keeps it for replay.
+func (h *Hub) PublishGameEvent(gameID int, msgType string, data interface{}) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("Failed to encode %s for game %d: %v", msgType, gameID, err)
+		return
+	}
+	h.publishEvent(busEvent{
+		Channel: gameChannel(gameID),
+		GameID:  gameID,
+		Type:    msgType,
+		Data:    encoded,
+	})
+}
+
+// Send queues message for a single client.
+func (h *Hub) Send(client *Client, message []byte) {
+	h.broadcast <- envelope{client: client, message: message}
+}
+
+func (h *Hub) run() {
+	pruneTicker := time.NewTicker(replayRetention / 2)
+	defer pruneTicker.Stop()
+
+	for {
+		select {
+		case client := <-h.register:
+			h.clients[client] = true
+			for channel := range client.channels {
+				h.addToChannel(client, channel)
+			}
+			log.Printf("Client registered: %s", client.name())
+
+		case client := <-h.unregister:
+			if _, ok := h.clients[client]; ok {
+				h.removeClient(client)
+				log.Printf("Client unregistered: %s", client.name())
+			}
+
+		case sub := <-h.subscribe:
+			h.handleSubscribe(sub)
+
+		case sub := <-h.unsubscribe:
+			if _, ok := h.clients[sub.client]; ok {
+				delete(sub.client.channels, sub.channel)
+				h.removeFromChannel(sub.client, sub.channel)
+				sub.client.sendJSON(models.MsgUnsubscribed, models.SubscriptionData{Channel: sub.channel})
+			}
+
+		case req := <-h.resume:
+			h.handleResume(req)
+
+		case result := <-h.states:
+			h.deliverState(result)
+
+		case channel := <-h.resyncs:
+			h.resync(channel)
+
+		case <-pruneTicker.C:
+			h.pruneLogs()
+
+		case env := <-h.broadcast:
+			if env.client != nil {
+				h.deliver(env)
+				continue
+			}
+			if env.gameID != 0 {
+				message, ok := h.sequence(env)
+				if !ok {
+					continue
+				}
+				env.message = message
+			}
+			recipientCount := h.publish(env)
+			log.Printf("Broadcast to %d clients (channel=%s)", recipientCount, env.channel)
+		}
+	}
+}
+
+func (h *Hub) handleSubscribe(sub subscription) {
+	if _, ok := h.clients[sub.client]; !ok {
+		return
+	}
+	alreadySubscribed := sub.client.channels[sub.channel]
+	if !h.addSubscription(sub.client, sub.channel) {
+		return
+	}
+	sub.client.sendJSON(models.MsgSubscribed, models.SubscriptionData{Channel: sub.channel})
+
+	// New subscribers get the current game, review or demo straight away
+	if !alreadySubscribed {
+		h.sendChannelState(sub.client, sub.channel)
+	}
+}
+
+// addSubscription subscribes client to channel unless it already follows
+// too many, in which case the client is told and false is returned.
+func (h *Hub) addSubscription(client *Client, channel string) bool {
+	if len(client.channels) >= maxSubscriptions && !client.channels[channel] {
+		client.sendJSON(models.MsgSubscribeError, models.SubscriptionData{
+			Channel: channel,
+			Error:   "Too many subscriptions",
+		})
+		return false
+	}
+
+	client.channels[channel] = true
+	h.addToChannel(client, channel)
+	return true
+}
+
+// deliver sends a directly addressed envelope if its client is still connected.
+func (h *Hub) deliver(env envelope) {
+	if _, ok := h.clients[env.client]; !ok {
+		return
+	}
+	h.sendOrDrop(env.client, env.message)
+}
+
+// sendOrDrop queues message for a registered client, disconnecting the
+// client if its send buffer is full. It is for messages a client cannot
+// miss, such as numbered game events: a client that reconnects and resumes
+// catches up, one that silently lost a message would not. It reports
+// whether the client is still connected.
+func (h *Hub) sendOrDrop(client *Client, message []byte) bool {
+	select {
+	case client.send <- message:
+		return true
+	default:
+		log.Printf("Dropping slow client: %s", client.name())
+		h.dropSlowClient(client)
+		return false
+	}
+}
+
+// publish delivers env to the members of its channel only, so the cost is
+// proportional to the room size rather than the number of connections.
+// Clients whose send buffer is full are disconnected. It returns the number
+// of recipients.
+func (h *Hub) publish(env envelope) int {
+	var slow []*Client
+	recipientCount := 0
+
+	for client := range h.channels[env.channel] {
+		// Clients waiting for a snapshot get the event after it
+		if pending, ok := client.pending[env.channel]; ok {
+			if len(pending) >= cap(client.send) {
+				slow = append(slow, client)
+				continue
+			}
+			client.pending[env.channel] = append(pending, env.message)
+			recipientCount++
+			continue
+		}
+
+		select {
+		case client.send <- env.message:
+			recipientCount++
+		default:
+			slow = append(slow, client)
+		}
+	}
+
+	// Dropped after the loop so the channel is not modified while ranging
+	// over it
+	for _, client := range slow {
+		if _, ok := h.clients[client]; ok {
+			log.Printf("Dropping slow client: %s", client.name())
+			h.dropSlowClient(client)
+		}
+	}
+
+	return recipientCount
+}
+
+// addToChannel indexes client under channel.
+func (h *Hub) addToChannel(client *Client, channel string) {
+	members, ok := h.channels[channel]
+	if !ok {
+		members = make(map[*Client]bool)
+		h.channels[channel] = members
+	}
+	members[client] = true
+}
+
+// removeFromChannel drops client from channel's index.
+func (h *Hub) removeFromChannel(client *Client, channel string) {
+	members, ok := h.channels[channel]
+	if !ok {
+		return
+	}
+	delete(members, client)
+	delete(client.pending, channel)
+	if len(members) == 0 {
+		delete(h.channels, channel)
+	}
+}
+
+// dropSlowClient disconnects a client that cannot keep up with its
+// subscriptions.
+func (h *Hub) dropSlowClient(client *Client) {
+	metrics.slowConsumers.Add(1)
+	client.closeCode = websocket.CloseTryAgainLater
+	client.closeReason = "client too slow"
+	h.removeClient(client)
+}
+
+// removeClient unregisters client from the hub and every channel it follows.
+func (h *Hub) removeClient(client *Client) {
+	for channel := range client.channels {
+		h.removeFromChannel(client, channel)
+	}
+	delete(h.clients, client)
+	close(client.send)
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"frogs_cafe/models"
+)
+
+// newBenchmarkHub returns a hub with rooms channels of members clients each.
+// It is driven directly rather than through run, so no database or bus is
+// needed.
+func newBenchmarkHub(rooms, members int) *Hub {
+	h := &Hub{
+		clients:  make(map[*Client]bool),
+		channels: make(map[string]map[*Client]bool),
+		logs:     make(map[int]*gameLog),
+	}
+	for room := range rooms {
+		channel := gameChannel(room + 1)
+		for range members {
+			client := &Client{
+				send:     make(chan []byte, 1), // Drained after every broadcast
+				channels: map[string]bool{channel: true},
+				pending:  make(map[string][][]byte),
+			}
+			h.clients[client] = true
+			h.addToChannel(client, channel)
+		}
+	}
+	return h
+}
+
+// BenchmarkBroadcast publishes to one room while the number of other rooms
+// varies. The time per broadcast should follow the room size and stay flat
+// as the total number of connections grows.
+func BenchmarkBroadcast(b *testing.B) {
+	message := []byte(`{"type":"move"}`)
+	for _, members := range []int{10, 100} {
+		for _, rooms := range []int{1, 100, 1000} {
+			b.Run(fmt.Sprintf("room=%d/rooms=%d", members, rooms), func(b *testing.B) {
+				h := newBenchmarkHub(rooms, members)
+				channel := gameChannel(1)
+				room := h.channels[channel]
+				env := envelope{channel: channel, message: message}
+
+				b.ResetTimer()
+				for range b.N {
+					if n := h.publish(env); n != members {
+						b.Fatalf("delivered to %d clients, want %d", n, members)
+					}
+					for client := range room {
+						<-client.send
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestSendStateHoldsEvents(t *testing.T) {
+	tests := []struct {
+		name     string
+		load     func() (interface{}, error)
+		wantType string
+	}{
+		{
+			name:     "snapshot",
+			load:     func() (interface{}, error) { return map[string]int{"id": 3}, nil },
+			wantType: models.MsgReviewState,
+		},
+		{
+			name:     "loader panics",
+			load:     func() (interface{}, error) { panic("bad review") },
+			wantType: models.MsgError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newBenchmarkHub(0, 0)
+			h.states = make(chan stateResult)
+			channel := reviewChannel(3)
+			client := &Client{
+				send:     make(chan []byte, 4),
+				channels: map[string]bool{channel: true},
+				pending:  make(map[string][][]byte),
+			}
+			h.clients[client] = true
+			h.addToChannel(client, channel)
+
+			h.sendState(client, channel, models.MsgReviewState, tt.load)
+			event := []byte(`{"type":"review_current"}`)
+			h.publish(envelope{channel: channel, message: event})
+			if len(client.send) != 0 {
+				t.Fatal("event sent before the snapshot")
+			}
+
+			h.deliverState(<-h.states)
+			if len(client.send) != 2 {
+				t.Fatalf("client got %d messages, want 2", len(client.send))
+			}
+			var first models.WebSocketMessage
+			if err := json.Unmarshal(<-client.send, &first); err != nil {
+				t.Fatal(err)
+			}
+			if first.Type != tt.wantType {
+				t.Errorf("first message is %s, want %s", first.Type, tt.wantType)
+			}
+			if got := <-client.send; string(got) != string(event) {
+				t.Errorf("second message = %s, want the held event", got)
+			}
+			if _, waiting := client.pending[channel]; waiting {
+				t.Error("client still waiting after the snapshot")
+			}
+		})
+	}
+}
+
+func TestSplitChannel(t *testing.T) {
+	tests := []struct {
+		channel string
+		kind    string
+		id      int
+		ok      bool
+	}{
+		{gameChannel(12), "game", 12, true},
+		{reviewChannel(3), "review", 3, true},
+		{demoChannel(5), "demo", 5, true},
+		{lobbyChannel, "", 0, false},
+		{"game:x", "game", 0, false},
+	}
+	for _, tt := range tests {
+		kind, id, ok := splitChannel(tt.channel)
+		if ok != tt.ok || (ok && (kind != tt.kind || id != tt.id)) {
+			t.Errorf("splitChannel(%q) = %q, %d, %v; want %q, %d, %v", tt.channel, kind, id, ok, tt.kind, tt.id, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"frogs_cafe/middleware"
+	"frogs_cafe/models"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// maxIdempotencyKeyLength matches the idempotency_keys column.
+const maxIdempotencyKeyLength = 255
+
+// abandonedClaimAge is how long a key may stay claimed without a result
+// before it is assumed that the request died and the key is free again.
+const abandonedClaimAge = time.Minute
+
+// idempotentResult is the stored outcome of an action submitted with an
+// idempotency key. REST endpoints and the WebSocket share the same records,
+// so a retry may switch transports.
+type idempotentResult struct {
+	action      string
+	status      int // 0 while the first attempt is still running
+	contentType string
+	body        []byte
+}
+
+// idempotencyAction names an action for matching retries: the kind of
+// action plus the game it applies to, if any.
+func idempotencyAction(kind, gameID string) string {
+	if gameID == "" {
+		return kind
+	}
+	return kind + ":" + gameID
+}
+
+// claimIdempotencyKey reserves key for action. It returns nil once the key
+// is claimed, or the result recorded by an earlier attempt within the
+// window, which the caller must replay instead of acting again.
+func (h *Handler) claimIdempotencyKey(playerID int, key, action string) (*idempotentResult, error) {
+	var claimed int
+	err := h.db.QueryRow(`
+		INSERT INTO idempotency_keys (player_id, idempotency_key, action) VALUES ($1, $2, $3)
+		ON CONFLICT (player_id, idempotency_key) DO UPDATE
+		SET action = EXCLUDED.action, status_code = 0, content_type = '', response = NULL, created_at = CURRENT_TIMESTAMP
+		WHERE idempotency_keys.created_at < CURRENT_TIMESTAMP - make_interval(secs => $4)
+			OR (idempotency_keys.status_code = 0 AND idempotency_keys.created_at < CURRENT_TIMESTAMP - make_interval(secs => $5))
+		RETURNING player_id`,
+		playerID, key, action, h.cfg.IdempotencyKeyTTL.Seconds(), abandonedClaimAge.Seconds(),
+	).Scan(&claimed)
+	if err == nil {
+		return nil, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	result := &idempotentResult{}
+	err = h.db.QueryRow(
+		"SELECT action, status_code, content_type, response FROM idempotency_keys WHERE player_id = $1 AND idempotency_key = $2",
+		playerID, key,
+	).Scan(&result.action, &result.status, &result.contentType, &result.body)
+	return result, err
+}
+
+// saveIdempotentResult records the outcome of a claimed key for replay.
+func (h *Handler) saveIdempotentResult(playerID int, key string, status int, contentType string, body []byte) {
+	_, err := h.db.Exec(
+		"UPDATE idempotency_keys SET status_code = $3, content_type = $4, response = $5 WHERE player_id = $1 AND idempotency_key = $2",
+		playerID, key, status, contentType, body,
+	)
+	if err != nil {
+		log.Printf("Failed to save idempotency key result: %v", err)
+	}
+}
+
+// releaseIdempotencyKey forgets a claimed key after a server error, so the
+// client's retry is attempted afresh.
+func (h *Handler) releaseIdempotencyKey(playerID int, key string) {
+	_, err := h.db.Exec(
+		"DELETE FROM idempotency_keys WHERE player_id = $1 AND idempotency_key = $2",
+		playerID, key,
+	)
+	if err != nil {
+		log.Printf("Failed to release idempotency key: %v", err)
+	}
+}
+
+// CleanupIdempotencyKeys deletes keys older than ttl and returns how many
+// were removed.
+func (h *Handler) CleanupIdempotencyKeys(ttl time.Duration) (int, error) {
+	result, err := h.db.Exec(
+		"DELETE FROM idempotency_keys WHERE created_at < CURRENT_TIMESTAMP - make_interval(secs => $1)",
+		ttl.Seconds(),
+	)
+	if err != nil {
+		return 0, err
+	}
+	count, err := result.RowsAffected()
+	return int(count), err
+}
+
+// recordingWriter passes a response through while keeping a copy of it.
+type recordingWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rw *recordingWriter) WriteHeader(status int) {
+	rw.status = status
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *recordingWriter) Write(b []byte) (int, error) {
+	rw.body.Write(b)
+	return rw.ResponseWriter.Write(b)
+}
+
+// Idempotent wraps an authenticated state-changing endpoint so that a
+// request repeated with the same Idempotency-Key header gets the original
+// response back instead of acting twice. Requests without the header are
+// passed through untouched.
+func (h *Handler) Idempotent(kind string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" {
+			next(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			writeError(w, http.StatusBadRequest, models.ErrCodeInvalidMessage, "Idempotency-Key is too long")
+			return
+		}
+		playerID, ok := middleware.GetPlayerID(r)
+		if !ok {
+			writeError(w, http.StatusUnauthorized, models.ErrCodeUnauthorized, "Unauthorized: Player ID not found")
+			return
+		}
+
+		action := idempotencyAction(kind, chi.URLParam(r, "gameID"))
+		prior, err := h.claimIdempotencyKey(playerID, key, action)
+		if err != nil {
+			log.Printf("Failed to claim idempotency key: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if prior != nil {
+			replayResult(w, prior, action)
+			return
+		}
+
+		rw := &recordingWriter{ResponseWriter: w, status: http.StatusOK}
+		next(rw, r)
+
+		// Server errors are not the client's fault; let the retry run again
+		if rw.status >= http.StatusInternalServerError {
+			h.releaseIdempotencyKey(playerID, key)
+			return
+		}
+		h.saveIdempotentResult(playerID, key, rw.status, rw.Header().Get("Content-Type"), rw.body.Bytes())
+	}
+}
+
+// replayResult answers a repeated REST request from its stored result.
+func replayResult(w http.ResponseWriter, prior *idempotentResult, action string) {
+	if prior.action != action {
+		writeError(w, http.StatusUnprocessableEntity, models.ErrCodeIdempotencyKeyReused, "Idempotency key was already used for a different request")
+		return
+	}
+	if prior.status == 0 {
+		w.Header().Set("Retry-After", "1")
+		writeError(w, http.StatusConflict, models.ErrCodeRequestInProgress, "A request with this idempotency key is still being processed")
+		return
+	}
+
+	if prior.contentType != "" {
+		w.Header().Set("Content-Type", prior.contentType)
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(prior.status)
+	if _, err := w.Write(prior.body); err != nil {
+		log.Printf("Failed to write replayed response: %v", err)
+	}
+}
+
+// playMoveOnce plays a WebSocket move at most once per idempotency key. The
+// result is stored as the REST endpoint would answer, so either transport
+// can replay it; a replayed success is sent back as a move message to this
+// client alone. playerID is the client's player at the time of the move.
+func (c *Client) playMoveOnce(playerID int, move models.MoveData) error {
+	h := hub.handler
+	key := move.IdempotencyKey
+	if len(key) > maxIdempotencyKeyLength {
+		return newProtocolError(models.ErrCodeInvalidMessage, "idempotency_key is too long")
+	}
+
+	action := idempotencyAction("move", strconv.Itoa(move.GameID))
+	prior, err := h.claimIdempotencyKey(playerID, key, action)
+	if err != nil {
+		log.Printf("Failed to claim idempotency key: %v", err)
+		return newProtocolError(models.ErrCodeMoveRejected, "Move could not be saved")
+	}
+	if prior != nil {
+		return c.replayMove(prior, action)
+	}
+
+	saved, err := h.playMove(move.GameID, playerID, move.X, move.Y, move.MoveNumber)
+	var mErr *moveError
+	if errors.As(err, &mErr) {
+		body, _ := json.Marshal(models.ErrorData{Code: mErr.code, Message: mErr.message})
+		h.saveIdempotentResult(playerID, key, mErr.status, "application/json", body)
+		return newProtocolError(mErr.code, "%s", mErr.message)
+	}
+	if err != nil {
+		h.releaseIdempotencyKey(playerID, key)
+		log.Printf("Error saving move: %v", err)
+		return newProtocolError(models.ErrCodeMoveRejected, "Move could not be saved")
+	}
+
+	body, err := json.Marshal(saved)
+	if err != nil {
+		log.Printf("Failed to marshal move: %v", err)
+		return nil
+	}
+	h.saveIdempotentResult(playerID, key, http.StatusCreated, "application/json", body)
+	return nil
+}
+
+// replayMove answers a repeated WebSocket move from its stored result.
+func (c *Client) replayMove(prior *idempotentResult, action string) error {
+	if prior.action != action {
+		return newProtocolError(models.ErrCodeIdempotencyKeyReused, "Idempotency key was already used for a different request")
+	}
+	if prior.status == 0 {
+		return newProtocolError(models.ErrCodeRequestInProgress, "A move with this idempotency key is still being processed")
+	}
+
+	if prior.status >= http.StatusBadRequest {
+		var refusal models.ErrorData
+		if err := json.Unmarshal(prior.body, &refusal); err != nil || refusal.Code == "" {
+			return newProtocolError(models.ErrCodeMoveRejected, "Move was rejected")
+		}
+		return newProtocolError(refusal.Code, "%s", refusal.Message)
+	}
+
+	var saved models.Move
+	if err := json.Unmarshal(prior.body, &saved); err != nil {
+		log.Printf("Failed to decode stored move: %v", err)
+		return newProtocolError(models.ErrCodeMoveRejected, "Move could not be replayed")
+	}
+	c.reply(models.MsgMove, models.MoveData{
+		X:          saved.X,
+		Y:          saved.Y,
+		GameID:     saved.GameID,
+		PlayerID:   saved.PlayerID,
+		MoveNumber: saved.MoveNumber,
+		Color:      saved.Color,
+	})
+	return nil
+}
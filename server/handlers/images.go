@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"iter"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"frogs_cafe/models"
+	"frogs_cafe/render"
+	"frogs_cafe/rules"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// imageRequest is a game loaded for drawing, with the drawing options
+// common to every image endpoint.
+type imageRequest struct {
+	game    models.Game
+	record  *models.GameRecord
+	moves   []models.Move
+	opts    render.Options
+	numbers bool
+}
+
+// BoardSVG draws a game's position as SVG. See loadImageRequest for the
+// query parameters.
+func (h *Handler) BoardSVG(w http.ResponseWriter, r *http.Request) {
+	req, ok := h.loadImageRequest(w, r)
+	if !ok {
+		return
+	}
+	pos, ok := req.positionAt(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	setPositionCaching(w, r, req.game)
+	if err := render.SVG(w, pos, req.opts); err != nil {
+		log.Printf("Failed to write SVG for game %d: %v", req.game.ID, err)
+	}
+}
+
+// BoardPNG draws a game's position as PNG. See loadImageRequest for the
+// query parameters.
+func (h *Handler) BoardPNG(w http.ResponseWriter, r *http.Request) {
+	req, ok := h.loadImageRequest(w, r)
+	if !ok {
+		return
+	}
+	pos, ok := req.positionAt(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	setPositionCaching(w, r, req.game)
+	if err := render.PNG(w, pos, req.opts); err != nil {
+		log.Printf("Failed to write PNG for game %d: %v", req.game.ID, err)
+	}
+}
+
+// ReplayGIF animates a game move by move. Besides the options of
+// loadImageRequest it takes delay, the time each move is shown in
+// milliseconds.
+func (h *Handler) ReplayGIF(w http.ResponseWriter, r *http.Request) {
+	req, ok := h.loadImageRequest(w, r)
+	if !ok {
+		return
+	}
+
+	delay := defaultReplayDelay
+	if value := r.URL.Query().Get("delay"); value != "" {
+		ms, err := strconv.Atoi(value)
+		if err != nil || ms < minReplayDelay || ms > maxReplayDelay {
+			http.Error(w, fmt.Sprintf("delay must be between %d and %d milliseconds", minReplayDelay, maxReplayDelay), http.StatusBadRequest)
+			return
+		}
+		delay = ms
+	}
+
+	// Drawing a frame costs about width² pixels, so refuse replays that
+	// would take too long or hold too many frames before encoding
+	width := req.opts.Width
+	if width == 0 {
+		width = render.DefaultWidth
+	}
+	frames := len(req.moves) + 1
+	if width*width*frames > maxReplayPixels {
+		maxWidth := int(math.Sqrt(float64(maxReplayPixels / frames)))
+		if maxWidth < render.MinWidth {
+			http.Error(w, "Game is too long to animate", http.StatusUnprocessableEntity)
+		} else {
+			http.Error(w, fmt.Sprintf("Replay too large; the width for this game can be at most %d", maxWidth), http.StatusBadRequest)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/gif")
+	// A replay of a game in progress grows with every move
+	if req.game.Status == "finished" || req.game.Status == "imported" {
+		w.Header().Set("Cache-Control", "public, max-age=60")
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	if err := render.Animate(w, req.replay(), req.opts, time.Duration(delay)*time.Millisecond); err != nil {
+		log.Printf("Failed to write replay for game %d: %v", req.game.ID, err)
+	}
+}
+
+// Replay frame delays, in milliseconds
+const (
+	defaultReplayDelay = 800
+	minReplayDelay     = 100
+	maxReplayDelay     = 10000
+)
+
+// maxReplayPixels caps the pixels drawn for a replay, width² per frame:
+// 1000 frames at the default width, or 40 at the largest.
+const maxReplayPixels = 160_000_000
+
+// replay yields the position before the first move and after each move,
+// reusing one board throughout.
+func (req *imageRequest) replay() iter.Seq[render.Position] {
+	return func(yield func(render.Position) bool) {
+		pos := render.Position{Board: rules.NewBoard(req.game.BoardSize)}
+		if req.record != nil {
+			setupBoard(pos.Board, req.record)
+		}
+		if req.numbers {
+			pos.Numbers = make(map[rules.Point]int)
+		}
+		if !yield(pos) {
+			return
+		}
+
+		for _, m := range req.moves {
+			replayMove(pos.Board, req.game, m)
+			pos.LastMove = nil
+			if !m.Pass {
+				pos.LastMove = &rules.Point{X: m.X, Y: m.Y}
+				if pos.Numbers != nil {
+					pos.Numbers[*pos.LastMove] = m.MoveNumber
+				}
+			}
+			if !yield(pos) {
+				return
+			}
+		}
+	}
+}
+
+// loadImageRequest loads the game named in the URL and reads the drawing
+// options: width (pixels), coordinates (default true) and numbers (print
+// move numbers on stones, default false). On failure it writes the error
+// response and returns false.
+func (h *Handler) loadImageRequest(w http.ResponseWriter, r *http.Request) (*imageRequest, bool) {
+	gameID := chi.URLParam(r, "gameID")
+	id, err := strconv.Atoi(gameID)
+	if err != nil {
+		http.Error(w, "Invalid game ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	params := r.URL.Query()
+	req := &imageRequest{opts: render.Options{Coordinates: true}}
+	if width := params.Get("width"); width != "" {
+		req.opts.Width, err = strconv.Atoi(width)
+		if err != nil || req.opts.Width < render.MinWidth || req.opts.Width > render.MaxWidth {
+			http.Error(w, fmt.Sprintf("width must be between %d and %d", render.MinWidth, render.MaxWidth), http.StatusBadRequest)
+			return nil, false
+		}
+	}
+	if req.opts.Coordinates, err = boolParam(params.Get("coordinates"), true); err != nil {
+		http.Error(w, "Invalid coordinates", http.StatusBadRequest)
+		return nil, false
+	}
+	if req.numbers, err = boolParam(params.Get("numbers"), false); err != nil {
+		http.Error(w, "Invalid numbers", http.StatusBadRequest)
+		return nil, false
+	}
+
+	req.game, err = h.getGame(id)
+	if err == nil {
+		req.moves, err = h.getMoves(id)
+	}
+	if err == nil {
+		req.record, err = h.getGameRecord(id)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Game not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	return req, true
+}
+
+// positionAt replays the game up to the move given by the move query
+// parameter, or to the end. On failure it writes the error response and
+// returns false.
+func (req *imageRequest) positionAt(w http.ResponseWriter, r *http.Request) (render.Position, bool) {
+	n, ok := moveParam(w, r, len(req.moves))
+	if !ok {
+		return render.Position{}, false
+	}
+
+	moves := req.moves[:n]
+	pos := render.Position{Board: replayGame(req.game, req.record, moves)}
+	if n > 0 && !moves[n-1].Pass {
+		pos.LastMove = &rules.Point{X: moves[n-1].X, Y: moves[n-1].Y}
+	}
+	if req.numbers {
+		pos.Numbers = make(map[rules.Point]int)
+		for _, m := range moves {
+			if !m.Pass {
+				pos.Numbers[rules.Point{X: m.X, Y: m.Y}] = m.MoveNumber
+			}
+		}
+	}
+	return pos, true
+}
+
+// moveParam parses the move query parameter, the number of moves played to
+// reach a position, out of total. It defaults to total, the latest
+// position, and answers 400 if it is out of range.
+func moveParam(w http.ResponseWriter, r *http.Request, total int) (int, bool) {
+	move := r.URL.Query().Get("move")
+	if move == "" {
+		return total, true
+	}
+	n, err := strconv.Atoi(move)
+	if err != nil || n < 0 || n > total {
+		http.Error(w, fmt.Sprintf("move must be between 0 and %d", total), http.StatusBadRequest)
+		return 0, false
+	}
+	return n, true
+}
+
+// boolParam parses an optional true/false query parameter.
+func boolParam(value string, fallback bool) (bool, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	return strconv.ParseBool(value)
+}
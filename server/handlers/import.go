@@ -0,0 +1,408 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"frogs_cafe/middleware"
+	"frogs_cafe/models"
+	"frogs_cafe/rules"
+	"frogs_cafe/sgf"
+)
+
+// maxSGFSize caps uploaded SGF files; a long game with comments is a few
+// tens of kilobytes.
+const maxSGFSize = 1 << 20
+
+// Longest game information values game_records can hold, in characters.
+// Longer SGF values are shortened rather than refused.
+const (
+	maxRecordText = 255
+	maxRecordRank = 50
+)
+
+// importedGame is an SGF main line converted for storage.
+type importedGame struct {
+	size              int
+	record            models.GameRecord
+	moves             []models.Move
+	droppedVariations int
+	warnings          []string
+}
+
+// importError is an SGF file that parses but cannot be imported.
+type importError struct {
+	message string
+}
+
+func (e *importError) Error() string {
+	return e.message
+}
+
+func newImportError(format string, args ...interface{}) error {
+	return &importError{message: fmt.Sprintf(format, args...)}
+}
+
+// ImportGame creates a game from an SGF file sent as the request body. The
+// main line is stored as an "imported" game for browsing and review; side
+// variations are not, but the original file is kept with them.
+func (h *Handler) ImportGame(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated player ID from context
+	playerID, ok := middleware.GetPlayerID(r)
+	if !ok {
+		http.Error(w, "Unauthorized: Player ID not found", http.StatusUnauthorized)
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSGFSize))
+	if err != nil {
+		writeSGFError(w, http.StatusRequestEntityTooLarge, err)
+		return
+	}
+	data, decodeWarnings := decodeSGF(data)
+
+	trees, err := sgf.Parse(data)
+	if err != nil {
+		writeSGFError(w, http.StatusBadRequest, err)
+		return
+	}
+	imported, err := importSGF(trees[0])
+	if err != nil {
+		writeSGFError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	imported.warnings = append(decodeWarnings, imported.warnings...)
+	if len(trees) > 1 {
+		imported.warnings = append(imported.warnings, fmt.Sprintf("File holds %d games; only the first was imported", len(trees)))
+	}
+	imported.record.Source = string(data)
+
+	game, err := h.saveImportedGame(playerID, imported)
+	if err != nil {
+		log.Printf("Failed to save imported game: %v", err)
+		http.Error(w, "Failed to save game", http.StatusInternalServerError)
+		return
+	}
+	imported.record.GameID = game.ID
+	log.Printf("Game #%d imported by player #%d with %d moves", game.ID, playerID, len(imported.moves))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(models.ImportGameResponse{
+		Game:              game,
+		Record:            imported.record,
+		Moves:             len(imported.moves),
+		DroppedVariations: imported.droppedVariations,
+		Warnings:          imported.warnings,
+	}); err != nil {
+		log.Printf("Failed to encode import response: %v", err)
+	}
+}
+
+// writeSGFError reports why a file was refused, with its position for
+// syntax errors.
+func writeSGFError(w http.ResponseWriter, status int, err error) {
+	body := models.SGFErrorData{Code: models.ErrCodeInvalidSGF, Message: err.Error()}
+	var syntaxErr *sgf.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		body.Message = syntaxErr.Msg
+		body.Line = syntaxErr.Line
+		body.Column = syntaxErr.Column
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("Failed to encode error response: %v", err)
+	}
+}
+
+// decodeSGF converts an uploaded SGF file to UTF-8 according to the charset
+// it declares with CA, listing any guesswork in the returned warnings. The
+// stored copy of the file is the converted text.
+func decodeSGF(data []byte) ([]byte, []string) {
+	var warnings []string
+	charset := sgf.Charset(data)
+	text, err := sgf.Decode(data, charset)
+	if err != nil {
+		warnings = append(warnings, fmt.Sprintf("Ignored CA[%s]: %v", charset, err))
+		charset = ""
+		text, _ = sgf.Decode(data, charset)
+	}
+	if !utf8.Valid(data) && (charset == "" || strings.EqualFold(charset, "UTF-8") || strings.EqualFold(charset, "UTF8")) {
+		warnings = append(warnings, "File is not valid UTF-8 and was read as Latin-1")
+	}
+	return text, warnings
+}
+
+// importSGF converts the main line of an SGF game tree, checking every move
+// against the rules. Problems that make the game unusable are returned as
+// *importError; anything merely left out is listed in warnings.
+func importSGF(root *sgf.Node) (*importedGame, error) {
+	if gm, ok := root.Get("GM"); ok && gm != "1" {
+		return nil, newImportError("Not a Go game (GM[%s])", gm)
+	}
+
+	imported := &importedGame{size: 19}
+	if sz, ok := root.Get("SZ"); ok {
+		width, height, rectangular := strings.Cut(sz, ":")
+		if rectangular && width != height {
+			return nil, newImportError("Rectangular boards (SZ[%s]) are not supported", sz)
+		}
+		size, err := strconv.Atoi(width)
+		if err != nil || size < 2 || size > sgf.MaxBoardSize {
+			return nil, newImportError("Invalid board size SZ[%s]", sz)
+		}
+		imported.size = size
+	}
+
+	record, err := importRecord(root, imported)
+	if err != nil {
+		return nil, err
+	}
+	imported.record = record
+
+	board := rules.NewBoard(imported.size)
+	setupBoard(board, &imported.record)
+
+	for node := root; node != nil; {
+		if err := imported.addMove(node, board, node == root); err != nil {
+			return nil, err
+		}
+		if len(node.Children) == 0 {
+			break
+		}
+		imported.droppedVariations += len(node.Children) - 1
+		node = node.Children[0]
+	}
+	if imported.droppedVariations > 0 {
+		imported.warnings = append(imported.warnings, fmt.Sprintf("%d variation(s) were not imported; they remain in the stored file", imported.droppedVariations))
+	}
+	return imported, nil
+}
+
+// importRecord reads the game information properties of the root node.
+func importRecord(root *sgf.Node, imported *importedGame) (models.GameRecord, error) {
+	text := func(id string) string {
+		value, _ := root.Get(id)
+		return strings.TrimSpace(value)
+	}
+	// field reads a property stored in a column of at most limit characters
+	field := func(id string, limit int) string {
+		value := text(id)
+		if utf8.RuneCountInString(value) > limit {
+			value = string([]rune(value)[:limit])
+			imported.warnings = append(imported.warnings, fmt.Sprintf("Shortened %s to %d characters", id, limit))
+		}
+		return value
+	}
+	record := models.GameRecord{
+		Name:      field("GN", maxRecordText),
+		Event:     field("EV", maxRecordText),
+		Place:     field("PC", maxRecordText),
+		Date:      field("DT", maxRecordText),
+		BlackName: field("PB", maxRecordText),
+		WhiteName: field("PW", maxRecordText),
+		BlackRank: field("BR", maxRecordRank),
+		WhiteRank: field("WR", maxRecordRank),
+		Rules:     field("RU", maxRecordText),
+		Overtime:  field("OT", maxRecordText),
+		Result:    field("RE", maxRecordText),
+	}
+
+	number := func(id string) *float64 {
+		value := text(id)
+		if value == "" {
+			return nil
+		}
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			imported.warnings = append(imported.warnings, fmt.Sprintf("Ignored invalid %s[%s]", id, value))
+			return nil
+		}
+		return &f
+	}
+	record.Komi = number("KM")
+	record.MainTime = number("TM")
+
+	if ha := text("HA"); ha != "" {
+		handicap, err := strconv.Atoi(ha)
+		if err != nil || handicap < 0 {
+			imported.warnings = append(imported.warnings, fmt.Sprintf("Ignored invalid HA[%s]", ha))
+		} else {
+			record.Handicap = handicap
+		}
+	}
+
+	switch text("PL") {
+	case "B":
+		record.FirstPlayer = rules.Black.String()
+	case "W":
+		record.FirstPlayer = rules.White.String()
+	}
+
+	var err error
+	if record.SetupBlack, err = sgf.ParsePointList(root.Values("AB"), imported.size); err != nil {
+		return record, newImportError("Invalid setup stone: %v", err)
+	}
+	if record.SetupWhite, err = sgf.ParsePointList(root.Values("AW"), imported.size); err != nil {
+		return record, newImportError("Invalid setup stone: %v", err)
+	}
+	return record, nil
+}
+
+// addMove imports the move in node, if it has one, after playing it on board.
+func (g *importedGame) addMove(node *sgf.Node, board *rules.Board, isRoot bool) error {
+	moveNumber := len(g.moves) + 1
+	if !isRoot && (node.Values("AB") != nil || node.Values("AW") != nil || node.Values("AE") != nil) {
+		g.warnings = append(g.warnings, fmt.Sprintf("Ignored setup stones before move %d", moveNumber))
+	}
+
+	black, isBlack := node.Get("B")
+	white, isWhite := node.Get("W")
+	if isBlack && isWhite {
+		return newImportError("Move %d is played by both black and white", moveNumber)
+	}
+	if !isBlack && !isWhite {
+		return nil
+	}
+
+	color, value := rules.Black, black
+	if isWhite {
+		color, value = rules.White, white
+	}
+	point, pass, err := sgf.ParseMove(value, g.size)
+	if err != nil {
+		return newImportError("Move %d: %v", moveNumber, err)
+	}
+
+	// Records do not always alternate, e.g. around handicap stones, so
+	// follow the colors as written
+	board.SetNext(color)
+	move := models.Move{MoveNumber: moveNumber, X: point.X, Y: point.Y, Color: color.String(), Pass: pass}
+	if pass {
+		move.X, move.Y = -1, -1
+		err = board.Pass(color)
+	} else {
+		_, err = board.Play(color, point.X, point.Y)
+	}
+	if err != nil {
+		return newImportError("Move %d (%s[%s]) is illegal: %v", moveNumber, strings.ToUpper(color.String()[:1]), value, err)
+	}
+
+	g.moves = append(g.moves, move)
+	return nil
+}
+
+// saveImportedGame stores an imported game, its moves and its record in one
+// transaction. Imported games belong to no players; creatorID is whoever
+// uploaded the file.
+func (h *Handler) saveImportedGame(creatorID int, imported *importedGame) (models.Game, error) {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return models.Game{}, err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			log.Printf("Failed to roll back import: %v", err)
+		}
+	}()
+
+	var game models.Game
+	err = tx.QueryRow(
+		"INSERT INTO games (black_player_id, white_player_id, board_size, status, creator_id) VALUES (NULL, NULL, $1, 'imported', $2) RETURNING id, black_player_id, white_player_id, board_size, status, winner_id, creator_id, created_at, updated_at",
+		imported.size, creatorID,
+	).Scan(&game.ID, &game.BlackPlayerID, &game.WhitePlayerID, &game.BoardSize, &game.Status, &game.WinnerID, &game.CreatorID, &game.CreatedAt, &game.UpdatedAt)
+	if err != nil {
+		return models.Game{}, err
+	}
+
+	stmt, err := tx.Prepare("INSERT INTO moves (game_id, move_number, x, y, color, is_pass) VALUES ($1, $2, $3, $4, $5, $6)")
+	if err != nil {
+		return models.Game{}, err
+	}
+	defer func() {
+		if err := stmt.Close(); err != nil {
+			log.Printf("Failed to close statement: %v", err)
+		}
+	}()
+	for _, m := range imported.moves {
+		if _, err := stmt.Exec(game.ID, m.MoveNumber, m.X, m.Y, m.Color, m.Pass); err != nil {
+			return models.Game{}, err
+		}
+	}
+
+	record := imported.record
+	record.GameID = game.ID
+	if err := insertGameRecord(tx, record); err != nil {
+		return models.Game{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.Game{}, err
+	}
+	return game, nil
+}
+
+func insertGameRecord(tx *sql.Tx, record models.GameRecord) error {
+	setupBlack, err := json.Marshal(pointsOrEmpty(record.SetupBlack))
+	if err != nil {
+		return err
+	}
+	setupWhite, err := json.Marshal(pointsOrEmpty(record.SetupWhite))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO game_records (game_id, name, event, place, date, black_name, white_name, black_rank, white_rank,
+			komi, handicap, rules, main_time, overtime, result, setup_black, setup_white, first_player, source)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19)`,
+		record.GameID, record.Name, record.Event, record.Place, record.Date, record.BlackName, record.WhiteName, record.BlackRank, record.WhiteRank,
+		record.Komi, record.Handicap, record.Rules, record.MainTime, record.Overtime, record.Result, setupBlack, setupWhite, record.FirstPlayer, record.Source,
+	)
+	return err
+}
+
+func pointsOrEmpty(points []rules.Point) []rules.Point {
+	if points == nil {
+		return []rules.Point{}
+	}
+	return points
+}
+
+// getGameRecord loads the record of an imported game, or nil if the game
+// was played here.
+func (h *Handler) getGameRecord(gameID int) (*models.GameRecord, error) {
+	record := &models.GameRecord{GameID: gameID}
+	var setupBlack, setupWhite []byte
+	err := h.db.QueryRow(
+		`SELECT name, event, place, date, black_name, white_name, black_rank, white_rank,
+			komi, handicap, rules, main_time, overtime, result, setup_black, setup_white, first_player
+		FROM game_records WHERE game_id = $1`,
+		gameID,
+	).Scan(&record.Name, &record.Event, &record.Place, &record.Date, &record.BlackName, &record.WhiteName, &record.BlackRank, &record.WhiteRank,
+		&record.Komi, &record.Handicap, &record.Rules, &record.MainTime, &record.Overtime, &record.Result, &setupBlack, &setupWhite, &record.FirstPlayer)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(setupBlack, &record.SetupBlack); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(setupWhite, &record.SetupWhite); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
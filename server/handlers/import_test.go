@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecodeSGF(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		want     string
+		warnings []string
+	}{
+		{
+			name:  "UTF-8",
+			input: "(;CA[UTF-8]PB[Café])",
+			want:  "(;CA[UTF-8]PB[Café])",
+		},
+		{
+			name:  "declared charset",
+			input: "(;CA[Shift_JIS]PB[\x8c\xe9])",
+			want:  "(;CA[Shift_JIS]PB[碁])",
+		},
+		{
+			name:     "Latin-1 without a charset",
+			input:    "(;PB[Caf\xe9])",
+			want:     "(;PB[Café])",
+			warnings: []string{"File is not valid UTF-8 and was read as Latin-1"},
+		},
+		{
+			name:     "unknown charset",
+			input:    "(;CA[klingon]PB[Caf\xe9])",
+			want:     "(;CA[klingon]PB[Café])",
+			warnings: []string{`Ignored CA[klingon]: unknown charset "klingon"`, "File is not valid UTF-8 and was read as Latin-1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, warnings := decodeSGF([]byte(tt.input))
+			if string(got) != tt.want {
+				t.Errorf("decodeSGF() = %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(warnings, tt.warnings) {
+				t.Errorf("warnings = %q, want %q", warnings, tt.warnings)
+			}
+		})
+	}
+}
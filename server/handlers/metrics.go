@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync/atomic"
+)
+
+// wsMetrics counts WebSocket connection events since the server started.
+type wsMetrics struct {
+	opened           atomic.Int64
+	closed           atomic.Int64
+	pongTimeouts     atomic.Int64
+	messageTooBig    atomic.Int64
+	slowConsumers    atomic.Int64
+	writeTimeouts    atomic.Int64
+	writeErrors      atomic.Int64
+	unexpectedCloses atomic.Int64
+
+	rateLimited          atomic.Int64 // Messages rejected by rate limits
+	rateLimitDisconnects atomic.Int64
+	rateLimitBans        atomic.Int64
+}
+
+var metrics wsMetrics
+
+func (h *Handler) Metrics(w http.ResponseWriter, r *http.Request) {
+	opened := metrics.opened.Load()
+	closed := metrics.closed.Load()
+
+	response := map[string]interface{}{
+		"websocket": map[string]interface{}{
+			"connections_opened": opened,
+			"connections_closed": closed,
+			"connections_active": opened - closed,
+			"dropped": map[string]int64{
+				"pong_timeout":     metrics.pongTimeouts.Load(),
+				"message_too_big":  metrics.messageTooBig.Load(),
+				"slow_consumer":    metrics.slowConsumers.Load(),
+				"write_timeout":    metrics.writeTimeouts.Load(),
+				"write_error":      metrics.writeErrors.Load(),
+				"unexpected_close": metrics.unexpectedCloses.Load(),
+				"rate_limit":       metrics.rateLimitDisconnects.Load(),
+			},
+			"rate_limited_messages": metrics.rateLimited.Load(),
+			"rate_limit_bans":       metrics.rateLimitBans.Load(),
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Failed to encode metrics response: %v", err)
+	}
+}
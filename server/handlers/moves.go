@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"frogs_cafe/middleware"
+	"frogs_cafe/models"
+	"frogs_cafe/rules"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/lib/pq"
+)
+
+// moveError is a move refused by validation. Both transports report it to
+// the player with the same code: the WebSocket as an error message, REST
+// as an ErrorData body with status.
+type moveError struct {
+	status  int
+	code    string
+	message string
+}
+
+func (e *moveError) Error() string {
+	return e.message
+}
+
+// SaveMove validates and stores a move in one transaction. The game row is
+// locked until it commits, so concurrent submissions for a game are checked
+// and numbered one at a time. expected is the move number the client thinks
+// it is playing, or 0 to skip the check; a mismatch means the client has
+// not seen the latest move and the submission is refused as stale.
+// Refusals are returned as *moveError.
+func (h *Handler) SaveMove(gameID, playerID, x, y, expected int) (models.Move, error) {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return models.Move{}, err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			log.Printf("Failed to roll back move: %v", err)
+		}
+	}()
+
+	game, err := lockGame(tx, gameID)
+	if err == sql.ErrNoRows {
+		return models.Move{}, &moveError{http.StatusNotFound, models.ErrCodeGameNotFound, "Game not found"}
+	}
+	if err != nil {
+		return models.Move{}, err
+	}
+	if game.Status != "active" {
+		return models.Move{}, &moveError{http.StatusConflict, models.ErrCodeGameNotActive, "Game is not in progress"}
+	}
+
+	color := playerColor(game, playerID)
+	if color == rules.Empty {
+		return models.Move{}, &moveError{http.StatusForbidden, models.ErrCodeNotAPlayer, "You are not playing in this game"}
+	}
+
+	moves, err := queryMoves(tx, gameID)
+	if err != nil {
+		return models.Move{}, err
+	}
+	move := models.Move{GameID: gameID, PlayerID: playerID, MoveNumber: 1, X: x, Y: y, Color: color.String()}
+	if len(moves) > 0 {
+		move.MoveNumber = moves[len(moves)-1].MoveNumber + 1
+	}
+	if expected != 0 && expected != move.MoveNumber {
+		return models.Move{}, &moveError{http.StatusConflict, models.ErrCodeStaleMove,
+			fmt.Sprintf("Expected to play move %d but the next move is %d", expected, move.MoveNumber)}
+	}
+
+	board := replayGame(game, nil, moves)
+	if board.Next() != color {
+		return models.Move{}, &moveError{http.StatusConflict, models.ErrCodeNotYourTurn, "It is not your turn"}
+	}
+	if _, err := board.Play(color, x, y); err != nil {
+		return models.Move{}, &moveError{http.StatusUnprocessableEntity, models.ErrCodeIllegalMove, "Illegal move: " + err.Error()}
+	}
+
+	err = tx.QueryRow(
+		"INSERT INTO moves (game_id, player_id, move_number, x, y, color) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at",
+		gameID, playerID, move.MoveNumber, x, y, move.Color,
+	).Scan(&move.ID, &move.CreatedAt)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		// The unique (game_id, move_number) constraint backs up the lock
+		return models.Move{}, &moveError{http.StatusConflict, models.ErrCodeStaleMove, "Another move was played first"}
+	}
+	if err != nil {
+		return models.Move{}, err
+	}
+
+	_, err = tx.Exec("UPDATE games SET updated_at = CURRENT_TIMESTAMP WHERE id = $1", gameID)
+	if err != nil {
+		return models.Move{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.Move{}, err
+	}
+	return move, nil
+}
+
+// playMove saves a move and broadcasts it to everyone following the game,
+// whichever transport it arrived on.
+func (h *Handler) playMove(gameID, playerID, x, y, expected int) (models.Move, error) {
+	move, err := h.SaveMove(gameID, playerID, x, y, expected)
+	if err != nil {
+		return models.Move{}, err
+	}
+
+	hub.PublishGameEvent(gameID, models.MsgMove, models.MoveData{
+		X:          move.X,
+		Y:          move.Y,
+		GameID:     move.GameID,
+		PlayerID:   move.PlayerID,
+		MoveNumber: move.MoveNumber,
+		Color:      move.Color,
+	})
+	return move, nil
+}
+
+// MakeMove plays a move for the authenticated player, for scripts and
+// clients that do not keep a WebSocket open. It returns the saved move, or
+// an ErrorData body explaining why the move was refused.
+func (h *Handler) MakeMove(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated player ID from context
+	playerID, ok := middleware.GetPlayerID(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, models.ErrCodeUnauthorized, "Unauthorized: Player ID not found")
+		return
+	}
+
+	gameID := chi.URLParam(r, "gameID")
+	id, err := strconv.Atoi(gameID)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, models.ErrCodeInvalidMessage, "Invalid game ID")
+		return
+	}
+
+	var req models.MakeMoveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, models.ErrCodeInvalidMessage, "Invalid request body")
+		return
+	}
+	// The game comes from the URL and the player from the session; the body
+	// may repeat them but not contradict them
+	if (req.GameID != 0 && req.GameID != id) || (req.PlayerID != 0 && req.PlayerID != playerID) {
+		writeError(w, http.StatusBadRequest, models.ErrCodeInvalidMessage, "game_id and player_id must match the URL and session")
+		return
+	}
+
+	move, err := h.playMove(id, playerID, req.X, req.Y, req.MoveNumber)
+	var mErr *moveError
+	if errors.As(err, &mErr) {
+		writeError(w, mErr.status, mErr.code, mErr.message)
+		return
+	}
+	if err != nil {
+		log.Printf("Error saving move: %v", err)
+		writeError(w, http.StatusInternalServerError, models.ErrCodeMoveRejected, "Move could not be saved")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(move); err != nil {
+		log.Printf("Failed to encode move response: %v", err)
+	}
+}
+
+// writeError sends a structured error for API clients that branch on code.
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(models.ErrorData{Code: code, Message: message}); err != nil {
+		log.Printf("Failed to encode error response: %v", err)
+	}
+}
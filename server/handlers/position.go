@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"frogs_cafe/models"
+	"frogs_cafe/rules"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// GetGamePosition returns the position after the number of moves given by
+// the move query parameter, or the latest position without it.
+func (h *Handler) GetGamePosition(w http.ResponseWriter, r *http.Request) {
+	gameID := chi.URLParam(r, "gameID")
+	id, err := strconv.Atoi(gameID)
+	if err != nil {
+		http.Error(w, "Invalid game ID", http.StatusBadRequest)
+		return
+	}
+
+	game, err := h.getGame(id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Game not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	moves, err := h.getMoves(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	record, err := h.getGameRecord(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	n, ok := moveParam(w, r, len(moves))
+	if !ok {
+		return
+	}
+	board := replayGame(game, record, moves[:n])
+	position := models.GamePosition{
+		GameID:     id,
+		MoveNumber: n,
+		TotalMoves: len(moves),
+		Board:      board.Grid(),
+		Captures:   boardCaptures(board),
+		ToMove:     board.Next().String(),
+	}
+	if ko, ok := board.Ko(); ok {
+		position.Ko = &ko
+	}
+	if n > 0 && !moves[n-1].Pass {
+		position.LastMove = &rules.Point{X: moves[n-1].X, Y: moves[n-1].Y}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	setPositionCaching(w, r, game)
+	if err := json.NewEncoder(w).Encode(position); err != nil {
+		log.Printf("Failed to encode position response: %v", err)
+	}
+}
+
+// setPositionCaching lets clients cache a response drawn from a position
+// only when the position cannot change: an explicit move of a game that is
+// over. Without move the response follows the latest move, so it must be
+// fetched afresh while the game goes on.
+func setPositionCaching(w http.ResponseWriter, r *http.Request, game models.Game) {
+	over := game.Status == "finished" || game.Status == "imported"
+	if over && r.URL.Query().Get("move") != "" {
+		w.Header().Set("Cache-Control", "public, max-age=60")
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+}
@@ -0,0 +1,305 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"unicode/utf8"
+
+	"frogs_cafe/auth"
+	"frogs_cafe/models"
+
+	"github.com/gorilla/websocket"
+)
+
+// maxChatLength is the longest chat message accepted, in characters.
+const maxChatLength = 500
+
+// messageHandler processes the payload of one client message type.
+type messageHandler func(c *Client, data json.RawMessage) error
+
+// messageHandlers dispatches incoming messages on their type. Anything not
+// registered here is rejected rather than relayed.
+var messageHandlers = map[string]messageHandler{
+	models.MsgAuthenticate: handleAuthenticate,
+	models.MsgSubscribe:    handleSubscribe,
+	models.MsgUnsubscribe:  handleUnsubscribe,
+	models.MsgResume:       handleResume,
+	models.MsgMove:         handleMove,
+	models.MsgChat:         handleChat,
+}
+
+// protocolError is a rejection reported back to the client as an error message.
+type protocolError struct {
+	code    string
+	message string
+}
+
+func (e *protocolError) Error() string {
+	return e.message
+}
+
+func newProtocolError(code, format string, args ...interface{}) error {
+	return &protocolError{code: code, message: fmt.Sprintf(format, args...)}
+}
+
+// encodeMessage builds the wire form of a server message.
+func encodeMessage(msgType string, data interface{}) ([]byte, error) {
+	return json.Marshal(models.WebSocketMessage{Type: msgType, Data: data})
+}
+
+// decodeStrict decodes data into v, rejecting unknown fields and trailing data.
+func decodeStrict(data []byte, v interface{}) error {
+	if len(data) == 0 {
+		return errors.New("missing data")
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if decoder.More() {
+		return errors.New("unexpected data after message")
+	}
+	return nil
+}
+
+// negotiateProtocol returns the protocol version requested by the client, or
+// false if the server does not support it. Clients that do not ask for a
+// version get the current one.
+func negotiateProtocol(requested string) (int, bool) {
+	if requested == "" {
+		return models.ProtocolVersion, true
+	}
+	for _, v := range models.SupportedProtocolVersions {
+		if fmt.Sprint(v) == requested {
+			return v, true
+		}
+	}
+	return 0, false
+}
+
+// handleMessage validates a raw client message and dispatches it to the
+// handler registered for its type. It returns false if the connection should
+// be closed.
+func (c *Client) handleMessage(raw []byte) bool {
+	var msg models.IncomingMessage
+	decodeErr := decodeStrict(raw, &msg)
+
+	// Malformed messages count against the limits too
+	switch c.checkRate(msg.Type) {
+	case rateDrop:
+		return true
+	case rateWarn:
+		c.reply(models.MsgError, models.ErrorData{
+			Code:    models.ErrCodeRateLimited,
+			Message: "Too many messages; slow down or you will be disconnected",
+			Type:    msg.Type,
+		})
+		return true
+	case rateDisconnect:
+		metrics.rateLimitDisconnects.Add(1)
+		log.Printf("Disconnecting %s for exceeding rate limits", c.name())
+		c.closeWith(websocket.ClosePolicyViolation, "rate limit exceeded")
+		return false
+	}
+
+	if decodeErr != nil {
+		log.Printf("Invalid message from %s: %v", c.name(), decodeErr)
+		c.reply(models.MsgError, models.ErrorData{
+			Code:    models.ErrCodeInvalidMessage,
+			Message: "Malformed message",
+		})
+		return true
+	}
+
+	handler, ok := messageHandlers[msg.Type]
+	if !ok {
+		log.Printf("Unknown message type %q from %s - dropped", msg.Type, c.name())
+		c.reply(models.MsgError, models.ErrorData{
+			Code:    models.ErrCodeUnknownType,
+			Message: "Unknown message type",
+			Type:    msg.Type,
+		})
+		return true
+	}
+
+	if err := handler(c, msg.Data); err != nil {
+		var perr *protocolError
+		if !errors.As(err, &perr) {
+			log.Printf("Error handling %s from %s: %v", msg.Type, c.name(), err)
+			perr = &protocolError{code: models.ErrCodeInvalidMessage, message: err.Error()}
+		}
+		c.reply(models.MsgError, models.ErrorData{
+			Code:    perr.code,
+			Message: perr.message,
+			Type:    msg.Type,
+		})
+	}
+	return true
+}
+
+// reply sends a message to this client only.
+func (c *Client) reply(msgType string, data interface{}) {
+	message, err := encodeMessage(msgType, data)
+	if err != nil {
+		log.Printf("Failed to marshal %s message: %v", msgType, err)
+		return
+	}
+	hub.Send(c, message)
+}
+
+func handleAuthenticate(c *Client, data json.RawMessage) error {
+	var req models.AuthenticateData
+	if err := decodeStrict(data, &req); err != nil {
+		return newProtocolError(models.ErrCodeInvalidMessage, "Invalid authenticate data: %v", err)
+	}
+
+	playerID, username, err := auth.ValidateSession(hub.handler.db.DB, req.Token)
+	if err != nil {
+		log.Printf("Authentication upgrade failed: %v", err)
+		c.reply(models.MsgAuthError, map[string]string{"error": "Invalid token"})
+		return nil
+	}
+	if _, banned := hub.limiter.bannedUntil(banKey(playerID, c.remoteIP)); banned {
+		c.reply(models.MsgAuthError, map[string]string{"error": "Temporarily banned for flooding"})
+		return nil
+	}
+
+	// Upgrade the client's credentials
+	c.setIdentity(playerID, username)
+	log.Printf("Client upgraded to authenticated user: %s (ID: %d)", username, playerID)
+
+	c.reply(models.MsgAuthSuccess, models.AuthSuccessData{
+		PlayerID: playerID,
+		Username: username,
+	})
+	return nil
+}
+
+func handleSubscribe(c *Client, data json.RawMessage) error {
+	sub, err := subscriptionFromData(c, data)
+	if err != nil {
+		return err
+	}
+	hub.subscribe <- sub
+	return nil
+}
+
+func handleUnsubscribe(c *Client, data json.RawMessage) error {
+	sub, err := subscriptionFromData(c, data)
+	if err != nil {
+		return err
+	}
+	hub.unsubscribe <- sub
+	return nil
+}
+
+func handleResume(c *Client, data json.RawMessage) error {
+	var req models.ResumeData
+	if err := decodeStrict(data, &req); err != nil {
+		return newProtocolError(models.ErrCodeInvalidMessage, "Invalid resume data: %v", err)
+	}
+	if req.GameID <= 0 {
+		return newProtocolError(models.ErrCodeInvalidMessage, "Resume requires a game_id")
+	}
+
+	hub.resume <- resumeRequest{
+		client:  c,
+		gameID:  req.GameID,
+		lastSeq: req.LastSeq,
+		epoch:   req.Epoch,
+	}
+	return nil
+}
+
+// subscriptionFromData resolves the channel named in a subscribe/unsubscribe
+// payload: {"game_id": 12} for a game, {"review_id": 3} for a review,
+// {"demo_id": 5} for a demo board or {"channel": "lobby"} for the lobby.
+func subscriptionFromData(c *Client, data json.RawMessage) (subscription, error) {
+	var req models.SubscribeData
+	if err := decodeStrict(data, &req); err != nil {
+		return subscription{}, newProtocolError(models.ErrCodeInvalidMessage, "Invalid subscription data: %v", err)
+	}
+	named := 0
+	for _, set := range []bool{req.GameID != nil, req.ReviewID != nil, req.DemoID != nil, req.Channel != ""} {
+		if set {
+			named++
+		}
+	}
+	switch {
+	case named != 1:
+	case req.GameID != nil && *req.GameID > 0:
+		return subscription{client: c, channel: gameChannel(*req.GameID)}, nil
+	case req.ReviewID != nil && *req.ReviewID > 0:
+		return subscription{client: c, channel: reviewChannel(*req.ReviewID)}, nil
+	case req.DemoID != nil && *req.DemoID > 0:
+		return subscription{client: c, channel: demoChannel(*req.DemoID)}, nil
+	case req.Channel == lobbyChannel:
+		return subscription{client: c, channel: lobbyChannel}, nil
+	}
+	return subscription{}, newProtocolError(models.ErrCodeInvalidMessage, "Subscription must name one of a game_id, a review_id, a demo_id or the lobby channel")
+}
+
+func handleMove(c *Client, data json.RawMessage) error {
+	// Only authenticated players can make moves
+	playerID, _ := c.identity()
+	if playerID == 0 {
+		return newProtocolError(models.ErrCodeUnauthorized, "Guests cannot make moves")
+	}
+
+	var move models.MoveData
+	if err := decodeStrict(data, &move); err != nil {
+		return newProtocolError(models.ErrCodeInvalidMessage, "Invalid move data: %v", err)
+	}
+	// A connection may follow several games, so the move must say which
+	if move.GameID <= 0 {
+		return newProtocolError(models.ErrCodeInvalidMessage, "Move requires a game_id")
+	}
+
+	// Use authenticated playerID from the session, not from the message
+	if move.IdempotencyKey != "" {
+		return c.playMoveOnce(playerID, move)
+	}
+
+	// move_number, if sent, is the number the client expects the move to get
+	_, err := hub.handler.playMove(move.GameID, playerID, move.X, move.Y, move.MoveNumber)
+	var mErr *moveError
+	if errors.As(err, &mErr) {
+		return newProtocolError(mErr.code, "%s", mErr.message)
+	}
+	if err != nil {
+		log.Printf("Error saving move: %v", err)
+		return newProtocolError(models.ErrCodeMoveRejected, "Move could not be saved")
+	}
+	return nil
+}
+
+func handleChat(c *Client, data json.RawMessage) error {
+	playerID, username := c.identity()
+	if playerID == 0 {
+		return newProtocolError(models.ErrCodeUnauthorized, "Guests cannot chat")
+	}
+
+	var chat models.ChatData
+	if err := decodeStrict(data, &chat); err != nil {
+		return newProtocolError(models.ErrCodeInvalidMessage, "Invalid chat data: %v", err)
+	}
+	chat.Text = strings.TrimSpace(chat.Text)
+	if chat.GameID <= 0 {
+		return newProtocolError(models.ErrCodeInvalidMessage, "Chat requires a game_id")
+	}
+	if chat.Text == "" || utf8.RuneCountInString(chat.Text) > maxChatLength {
+		return newProtocolError(models.ErrCodeInvalidMessage, "Chat text must be 1-%d characters", maxChatLength)
+	}
+
+	// Identify the sender from the session, not from the message
+	chat.PlayerID = playerID
+	chat.Username = username
+
+	hub.PublishGameEvent(chat.GameID, models.MsgChat, chat)
+	return nil
+}
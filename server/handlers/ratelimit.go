@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"frogs_cafe/config"
+	"frogs_cafe/models"
+)
+
+const (
+	// violationWindow is how long a client must behave before its
+	// violation count is forgiven.
+	violationWindow = time.Minute
+
+	// limiterPruneInterval is how often idle per-player buckets and expired
+	// bans are cleaned up.
+	limiterPruneInterval = 5 * time.Minute
+)
+
+// messageClass groups message types that share a rate limit.
+type messageClass int
+
+const (
+	classMove messageClass = iota
+	classChat
+	classOther
+	numMessageClasses
+)
+
+func classifyMessage(msgType string) messageClass {
+	switch msgType {
+	case models.MsgMove:
+		return classMove
+	case models.MsgChat:
+		return classChat
+	default:
+		return classOther
+	}
+}
+
+// rateDecision is what to do with a message after rate limiting.
+type rateDecision int
+
+const (
+	rateAllow rateDecision = iota
+	rateDrop
+	rateWarn
+	rateDisconnect
+)
+
+// tokenBucket allows bursts of up to burst messages, refilled at rate per
+// second. It is not safe for concurrent use.
+type tokenBucket struct {
+	tokens float64
+	rate   float64
+	burst  float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int, now time.Time) *tokenBucket {
+	return &tokenBucket{tokens: float64(burst), rate: rate, burst: float64(burst), last: now}
+}
+
+func (b *tokenBucket) allow(now time.Time) bool {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// buckets holds one token bucket per message class.
+type buckets [numMessageClasses]*tokenBucket
+
+func newBuckets(cfg *config.Config, now time.Time) buckets {
+	return buckets{
+		classMove:  newTokenBucket(cfg.RateLimitMoves, cfg.RateLimitMovesBurst, now),
+		classChat:  newTokenBucket(cfg.RateLimitChat, cfg.RateLimitChatBurst, now),
+		classOther: newTokenBucket(cfg.RateLimitOther, cfg.RateLimitOtherBurst, now),
+	}
+}
+
+// connLimits is the rate limiting state of a single connection. It is only
+// used from the connection's readPump.
+type connLimits struct {
+	buckets       buckets
+	violations    int
+	lastViolation time.Time
+}
+
+// strike counts recent rate limit disconnects of a player or guest IP.
+type strike struct {
+	count   int
+	expires time.Time
+}
+
+// rateLimiter holds the limits shared by every connection of a player, along
+// with disconnect strikes and temporary bans. Guests are identified by IP
+// address for strikes and bans.
+type rateLimiter struct {
+	cfg      *config.Config
+	mutex    sync.Mutex
+	players  map[int]buckets
+	lastSeen map[int]time.Time
+	strikes  map[string]strike
+	bans     map[string]time.Time
+}
+
+func newRateLimiter(cfg *config.Config) *rateLimiter {
+	return &rateLimiter{
+		cfg:      cfg,
+		players:  make(map[int]buckets),
+		lastSeen: make(map[int]time.Time),
+		strikes:  make(map[string]strike),
+		bans:     make(map[string]time.Time),
+	}
+}
+
+// banKey identifies who a strike or ban applies to.
+func banKey(playerID int, remoteIP string) string {
+	if playerID != 0 {
+		return fmt.Sprintf("player:%d", playerID)
+	}
+	return "ip:" + remoteIP
+}
+
+// bannedUntil returns when the ban on key ends, or false if there is none.
+func (l *rateLimiter) bannedUntil(key string) (time.Time, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	until, ok := l.bans[key]
+	if !ok || time.Now().After(until) {
+		return time.Time{}, false
+	}
+	return until, true
+}
+
+// allowPlayer takes a token from the player's shared bucket for class.
+func (l *rateLimiter) allowPlayer(playerID int, class messageClass, now time.Time) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	b, ok := l.players[playerID]
+	if !ok {
+		b = newBuckets(l.cfg, now)
+		l.players[playerID] = b
+	}
+	l.lastSeen[playerID] = now
+	return b[class].allow(now)
+}
+
+// recordDisconnect adds a strike against key and bans it once it has been
+// disconnected too often.
+func (l *rateLimiter) recordDisconnect(key string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now()
+	s := l.strikes[key]
+	if now.After(s.expires) {
+		s = strike{}
+	}
+	s.count++
+	s.expires = now.Add(l.cfg.RateLimitBanDuration)
+	l.strikes[key] = s
+
+	if s.count >= l.cfg.RateLimitBanAfter {
+		l.bans[key] = now.Add(l.cfg.RateLimitBanDuration)
+		delete(l.strikes, key)
+		metrics.rateLimitBans.Add(1)
+		log.Printf("Banned %s from WebSockets for %s after repeated flooding", key, l.cfg.RateLimitBanDuration)
+	}
+}
+
+// pruneLoop cleans up the limiter every limiterPruneInterval. Guests never
+// touch the per-player buckets, so their strikes and bans would otherwise
+// pile up for good.
+func (l *rateLimiter) pruneLoop() {
+	ticker := time.NewTicker(limiterPruneInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		l.mutex.Lock()
+		l.prune(now)
+		l.mutex.Unlock()
+	}
+}
+
+// prune drops idle player buckets, expired strikes and expired bans.
+// Callers must hold l.mutex.
+func (l *rateLimiter) prune(now time.Time) {
+	for playerID, seen := range l.lastSeen {
+		if now.Sub(seen) > limiterPruneInterval {
+			delete(l.players, playerID)
+			delete(l.lastSeen, playerID)
+		}
+	}
+	for key, s := range l.strikes {
+		if now.After(s.expires) {
+			delete(l.strikes, key)
+		}
+	}
+	for key, until := range l.bans {
+		if now.After(until) {
+			delete(l.bans, key)
+		}
+	}
+}
+
+// checkRate applies the connection and player limits to a message of
+// msgType and decides how to respond, escalating with each violation.
+func (c *Client) checkRate(msgType string) rateDecision {
+	playerID, _ := c.identity()
+	return hub.limiter.check(&c.limits, banKey(playerID, c.remoteIP), playerID, msgType, time.Now())
+}
+
+// check charges a message of msgType to a connection's limits and, for a
+// player, to the limits they share across connections. Repeated violations
+// escalate from dropping the message to a warning to a disconnect, which
+// counts as a strike against key.
+func (l *rateLimiter) check(limits *connLimits, key string, playerID int, msgType string, now time.Time) rateDecision {
+	class := classifyMessage(msgType)
+
+	// Both limits are charged so a player cannot dodge theirs by opening
+	// more connections
+	allowed := limits.buckets[class].allow(now)
+	if playerID != 0 && !l.allowPlayer(playerID, class, now) {
+		allowed = false
+	}
+	if allowed {
+		return rateAllow
+	}
+
+	if now.Sub(limits.lastViolation) > violationWindow {
+		limits.violations = 0
+	}
+	limits.violations++
+	limits.lastViolation = now
+	metrics.rateLimited.Add(1)
+
+	switch {
+	case limits.violations >= l.cfg.RateLimitDisconnectAfter:
+		l.recordDisconnect(key)
+		return rateDisconnect
+	case limits.violations >= l.cfg.RateLimitWarnAfter:
+		return rateWarn
+	default:
+		return rateDrop
+	}
+}
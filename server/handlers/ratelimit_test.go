@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"frogs_cafe/config"
+	"frogs_cafe/models"
+)
+
+func testLimiterConfig() *config.Config {
+	return &config.Config{
+		RateLimitMoves:           1,
+		RateLimitMovesBurst:      2,
+		RateLimitChat:            1,
+		RateLimitChatBurst:       2,
+		RateLimitOther:           1,
+		RateLimitOtherBurst:      2,
+		RateLimitWarnAfter:       3,
+		RateLimitDisconnectAfter: 5,
+		RateLimitBanAfter:        2,
+		RateLimitBanDuration:     time.Minute,
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	start := time.Now()
+	b := newTokenBucket(2, 3, start)
+
+	for i := range 3 {
+		if !b.allow(start) {
+			t.Fatalf("message %d of the burst refused", i+1)
+		}
+	}
+	if b.allow(start) {
+		t.Fatal("message beyond the burst allowed")
+	}
+
+	// Two tokens a second: one is back after half a second, not before
+	if b.allow(start.Add(400 * time.Millisecond)) {
+		t.Error("allowed before a token was refilled")
+	}
+	if !b.allow(start.Add(500 * time.Millisecond)) {
+		t.Error("refused after a token was refilled")
+	}
+
+	// A long pause refills no more than the burst
+	later := start.Add(time.Hour)
+	for i := range 3 {
+		if !b.allow(later) {
+			t.Fatalf("message %d after a pause refused", i+1)
+		}
+	}
+	if b.allow(later) {
+		t.Error("refill exceeded the burst")
+	}
+}
+
+func TestRateEscalation(t *testing.T) {
+	cfg := testLimiterConfig()
+	l := newRateLimiter(cfg)
+	now := time.Now()
+	key := banKey(0, "192.0.2.1")
+
+	// A guest connection flooding chat: the burst passes, then violations
+	// escalate at the configured thresholds
+	flood := func() []rateDecision {
+		limits := connLimits{buckets: newBuckets(cfg, now)}
+		var decisions []rateDecision
+		for range cfg.RateLimitChatBurst + cfg.RateLimitDisconnectAfter {
+			decisions = append(decisions, l.check(&limits, key, 0, models.MsgChat, now))
+		}
+		return decisions
+	}
+	want := []rateDecision{rateAllow, rateAllow, rateDrop, rateDrop, rateWarn, rateWarn, rateDisconnect}
+	got := flood()
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("decisions = %v, want %v", got, want)
+		}
+	}
+	if _, banned := l.bannedUntil(key); banned {
+		t.Fatal("banned after a single disconnect")
+	}
+
+	// The second disconnect reaches RateLimitBanAfter
+	flood()
+	until, banned := l.bannedUntil(key)
+	if !banned {
+		t.Fatal("not banned after repeated disconnects")
+	}
+	if d := time.Until(until); d <= 0 || d > cfg.RateLimitBanDuration {
+		t.Errorf("ban lasts %s, want up to %s", d, cfg.RateLimitBanDuration)
+	}
+	if _, banned := l.bannedUntil(banKey(0, "192.0.2.2")); banned {
+		t.Error("ban applied to another address")
+	}
+
+	// Expired bans are pruned
+	l.mutex.Lock()
+	l.prune(until.Add(time.Second))
+	remaining := len(l.bans)
+	l.mutex.Unlock()
+	if remaining != 0 {
+		t.Errorf("%d bans left after they expired", remaining)
+	}
+}
+
+func TestRateViolationsForgiven(t *testing.T) {
+	cfg := testLimiterConfig()
+	l := newRateLimiter(cfg)
+	now := time.Now()
+	limits := connLimits{buckets: newBuckets(cfg, now)}
+	key := banKey(0, "192.0.2.1")
+
+	for range cfg.RateLimitChatBurst + cfg.RateLimitWarnAfter - 1 {
+		l.check(&limits, key, 0, models.MsgChat, now)
+	}
+
+	// After a quiet spell the count starts again, so the next violation is
+	// only dropped rather than warned about
+	later := now.Add(violationWindow + time.Second)
+	limits.buckets = newBuckets(cfg, later)
+	for range cfg.RateLimitChatBurst {
+		l.check(&limits, key, 0, models.MsgChat, later)
+	}
+	if got := l.check(&limits, key, 0, models.MsgChat, later); got != rateDrop {
+		t.Errorf("decision after the violation window = %v, want drop", got)
+	}
+}
+
+func TestPlayerLimitsShared(t *testing.T) {
+	cfg := testLimiterConfig()
+	l := newRateLimiter(cfg)
+	now := time.Now()
+	const playerID = 7
+	key := banKey(playerID, "192.0.2.1")
+
+	first := connLimits{buckets: newBuckets(cfg, now)}
+	for range cfg.RateLimitMovesBurst {
+		if got := l.check(&first, key, playerID, models.MsgMove, now); got != rateAllow {
+			t.Fatalf("move within the burst = %v, want allow", got)
+		}
+	}
+
+	// A fresh connection has its own bucket but shares the player's
+	second := connLimits{buckets: newBuckets(cfg, now)}
+	if got := l.check(&second, key, playerID, models.MsgMove, now); got == rateAllow {
+		t.Error("a new connection escaped the player's limit")
+	}
+
+	// Other classes have buckets of their own
+	if got := l.check(&second, key, playerID, models.MsgChat, now); got != rateAllow {
+		t.Errorf("chat after moves = %v, want allow", got)
+	}
+}
+
+func TestBanKey(t *testing.T) {
+	if got := banKey(7, "192.0.2.1"); got != "player:7" {
+		t.Errorf("player key = %q", got)
+	}
+	if got := banKey(0, "192.0.2.1"); got != "ip:192.0.2.1" {
+		t.Errorf("guest key = %q", got)
+	}
+}
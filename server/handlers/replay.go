@@ -0,0 +1,295 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"frogs_cafe/models"
+)
+
+const (
+	// replayBufferSize is how many recent events are kept per game for resume.
+	replayBufferSize = 100
+
+	// replayRetention is how long the events of a game nobody is watching
+	// are kept before they are discarded.
+	replayRetention = 30 * time.Minute
+)
+
+// gameLog holds the most recent events of a game so reconnecting clients can
+// catch up without a full snapshot.
+type gameLog struct {
+	lastSeq   int64
+	events    [][]byte // events[len(events)-1] has sequence number lastSeq
+	updatedAt time.Time
+}
+
+func (l *gameLog) append(message []byte) {
+	l.events = append(l.events, message)
+	if len(l.events) > replayBufferSize {
+		l.events = l.events[len(l.events)-replayBufferSize:]
+	}
+	l.updatedAt = time.Now()
+}
+
+// since returns every event after seq, or false if some of them have
+// already been discarded or seq was never issued.
+func (l *gameLog) since(seq int64) ([][]byte, bool) {
+	if seq < 0 || seq > l.lastSeq {
+		return nil, false
+	}
+	firstSeq := l.lastSeq - int64(len(l.events)) + 1
+	if seq+1 < firstSeq {
+		return nil, false
+	}
+	return l.events[seq+1-firstSeq:], true
+}
+
+// resumeRequest asks the hub to subscribe a reconnecting client to a game
+// and bring it up to date.
+type resumeRequest struct {
+	client  *Client
+	gameID  int
+	lastSeq int64
+	epoch   string
+}
+
+// stateResult carries an encoded snapshot of a channel, such as a
+// game_state, back to the hub, which sends it ahead of any events held for
+// the client in the meantime.
+type stateResult struct {
+	client  *Client
+	channel string
+	message []byte
+}
+
+func newEpoch() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		// Fall back to the clock; it only needs to differ between runs
+		return time.Now().Format("20060102150405.000000000")
+	}
+	return hex.EncodeToString(b)
+}
+
+// sequence assigns env the next sequence number of its game, encodes it and
+// records it for replay. Must only be called from the hub goroutine.
+func (h *Hub) sequence(env envelope) ([]byte, bool) {
+	l, ok := h.logs[env.gameID]
+	if !ok {
+		l = &gameLog{}
+		h.logs[env.gameID] = l
+	}
+
+	message, err := json.Marshal(models.WebSocketMessage{
+		Type: env.msgType,
+		Seq:  l.lastSeq + 1,
+		Data: env.data,
+	})
+	if err != nil {
+		log.Printf("Failed to marshal %s event for game %d: %v", env.msgType, env.gameID, err)
+		return nil, false
+	}
+
+	l.lastSeq++
+	l.append(message)
+	return message, true
+}
+
+// lastSeq returns the sequence number of the most recent event of gameID.
+func (h *Hub) lastSeq(gameID int) int64 {
+	if l, ok := h.logs[gameID]; ok {
+		return l.lastSeq
+	}
+	return 0
+}
+
+func (h *Hub) handleResume(req resumeRequest) {
+	if _, ok := h.clients[req.client]; !ok {
+		return
+	}
+
+	channel := gameChannel(req.gameID)
+	if !h.addSubscription(req.client, channel) {
+		return
+	}
+
+	// Subscribing and replaying in the same step means no event can fall
+	// between the two
+	if req.epoch == h.epoch {
+		var events [][]byte
+		ok := req.lastSeq == 0
+		if l, exists := h.logs[req.gameID]; exists {
+			events, ok = l.since(req.lastSeq)
+		}
+		if ok {
+			for _, event := range events {
+				if !h.sendOrDrop(req.client, event) {
+					return
+				}
+			}
+			resumed, err := encodeMessage(models.MsgResumed, models.ResumedData{
+				GameID:   req.gameID,
+				Seq:      h.lastSeq(req.gameID),
+				Replayed: len(events),
+			})
+			if err != nil {
+				log.Printf("Failed to marshal %s message: %v", models.MsgResumed, err)
+				return
+			}
+			h.sendOrDrop(req.client, resumed)
+			return
+		}
+	}
+
+	// Too far behind, or sequence numbers from another server run: hold
+	// back live events until a fresh snapshot has been sent
+	h.sendGameState(req.client, req.gameID)
+}
+
+// sendChannelState sends client a snapshot of what channel follows: a
+// game_state for a game, a review_state for a review or a demo_state for a
+// demo board. It reports false for channels without one, such as the lobby.
+func (h *Hub) sendChannelState(client *Client, channel string) bool {
+	kind, id, ok := splitChannel(channel)
+	if !ok {
+		return false
+	}
+	switch kind {
+	case "game":
+		h.sendGameState(client, id)
+	case "review":
+		h.sendState(client, channel, models.MsgReviewState, func() (interface{}, error) {
+			return h.handler.getReview(id)
+		})
+	case "demo":
+		h.sendState(client, channel, models.MsgDemoState, func() (interface{}, error) {
+			demo, actions, err := h.handler.getDemo(id)
+			if err != nil {
+				return nil, err
+			}
+			return demoState(demo, actions), nil
+		})
+	default:
+		return false
+	}
+	return true
+}
+
+// sendGameState loads a snapshot of gameID for client.
+func (h *Hub) sendGameState(client *Client, gameID int) {
+	channel := gameChannel(gameID)
+	seq := h.lastSeq(gameID)
+	spectators := len(h.channels[channel])
+
+	h.sendState(client, channel, models.MsgGameState, func() (interface{}, error) {
+		state, err := h.handler.loadGameState(gameID)
+		if err != nil {
+			return nil, err
+		}
+		state.Seq = seq
+		state.Spectators = spectators
+		return state, nil
+	})
+}
+
+// sendState sends client a snapshot of channel as a msgType message, loaded
+// by load on a goroutine of its own. Events published on channel while it
+// loads are held and delivered after it. load must not touch the hub.
+func (h *Hub) sendState(client *Client, channel, msgType string, load func() (interface{}, error)) {
+	client.pending[channel] = [][]byte{}
+
+	go func() {
+		result := stateResult{client: client, channel: channel}
+
+		state, err := safeLoadState(load)
+		if err != nil {
+			log.Printf("Failed to load %s for %s: %v", msgType, channel, err)
+			result.message, err = encodeMessage(models.MsgError, models.ErrorData{
+				Code:    models.ErrCodeInvalidMessage,
+				Message: "State unavailable",
+				Type:    msgType,
+			})
+		} else {
+			result.message, err = encodeMessage(msgType, state)
+		}
+		if err != nil {
+			log.Printf("Failed to marshal %s for %s: %v", msgType, channel, err)
+		}
+
+		h.states <- result
+	}()
+}
+
+// safeLoadState runs a snapshot loader for sendState, where a panic caused
+// by one bad game, review or demo would take down the whole server.
+func safeLoadState(load func() (interface{}, error)) (state interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			state, err = nil, fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return load()
+}
+
+// resync sends a fresh snapshot to the subscribers of a channel whose event
+// never arrived. Game events are numbered by each hub as they arrive, so
+// clients cannot notice the gap themselves. Subscribers already waiting for
+// a snapshot are left to it, as it is almost always read after the event
+// was committed.
+func (h *Hub) resync(channel string) {
+	count := 0
+	for client := range h.channels[channel] {
+		if _, waiting := client.pending[channel]; waiting {
+			continue
+		}
+		if !h.sendChannelState(client, channel) {
+			log.Printf("Lost a pub/sub event for %s; subscribers may be out of date", channel)
+			return
+		}
+		count++
+	}
+	log.Printf("Lost a pub/sub event for %s; resynchronising %d clients", channel, count)
+}
+
+// deliverState sends a snapshot loaded by sendState, followed by the events
+// held for the client while it loaded.
+func (h *Hub) deliverState(result stateResult) {
+	if _, ok := h.clients[result.client]; !ok {
+		return
+	}
+	pending, ok := result.client.pending[result.channel]
+	if !ok {
+		// Unsubscribed while the snapshot was loading
+		return
+	}
+	delete(result.client.pending, result.channel)
+
+	// The held events only make sense after the snapshot, so a client that
+	// cannot take all of them is disconnected to start over
+	if result.message != nil && !h.sendOrDrop(result.client, result.message) {
+		return
+	}
+	for _, event := range pending {
+		if !h.sendOrDrop(result.client, event) {
+			return
+		}
+	}
+}
+
+// pruneLogs discards the buffered events of games nobody is watching. The
+// last sequence number is kept so numbering never restarts within a run.
+func (h *Hub) pruneLogs() {
+	for gameID, l := range h.logs {
+		if len(l.events) == 0 || time.Since(l.updatedAt) < replayRetention {
+			continue
+		}
+		if len(h.channels[gameChannel(gameID)]) == 0 {
+			l.events = nil
+		}
+	}
+}
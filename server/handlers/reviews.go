@@ -0,0 +1,825 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"frogs_cafe/middleware"
+	"frogs_cafe/models"
+	"frogs_cafe/rules"
+	"frogs_cafe/sgf"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	maxReviewTitleLength   = 255
+	maxReviewCommentLength = 5000
+)
+
+// reviewError is a review change refused by validation, reported to the
+// owner with status.
+type reviewError struct {
+	status  int
+	message string
+}
+
+func (e *reviewError) Error() string {
+	return e.message
+}
+
+// writeReviewError reports err, logging anything that is not a refusal.
+func writeReviewError(w http.ResponseWriter, err error) {
+	var rErr *reviewError
+	if errors.As(err, &rErr) {
+		http.Error(w, rErr.message, rErr.status)
+		return
+	}
+	log.Printf("Error updating review: %v", err)
+	http.Error(w, "Internal server error", http.StatusInternalServerError)
+}
+
+// CreateReview starts a review of a finished or imported game. The review's
+// tree begins with the game as it was played, as the main line below the
+// root.
+func (h *Handler) CreateReview(w http.ResponseWriter, r *http.Request) {
+	playerID, ok := middleware.GetPlayerID(r)
+	if !ok {
+		http.Error(w, "Unauthorized: Player ID not found", http.StatusUnauthorized)
+		return
+	}
+
+	gameID := chi.URLParam(r, "gameID")
+	id, err := strconv.Atoi(gameID)
+	if err != nil {
+		http.Error(w, "Invalid game ID", http.StatusBadRequest)
+		return
+	}
+
+	// The body is optional
+	var req models.CreateReviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.Title = strings.TrimSpace(req.Title)
+	if utf8.RuneCountInString(req.Title) > maxReviewTitleLength {
+		http.Error(w, fmt.Sprintf("Title must be at most %d characters", maxReviewTitleLength), http.StatusBadRequest)
+		return
+	}
+
+	game, err := h.getGame(id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Game not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if game.Status != "finished" && game.Status != "imported" {
+		http.Error(w, "Only finished games can be reviewed", http.StatusConflict)
+		return
+	}
+
+	moves, err := h.getMoves(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	record, err := h.getGameRecord(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	review, err := h.createReview(game, record, moves, playerID, req.Title)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(review); err != nil {
+		log.Printf("Failed to encode review response: %v", err)
+	}
+}
+
+// createReview stores a new review of game with the moves that were played
+// as its main line. Moves the rules reject are left out, as when replaying.
+func (h *Handler) createReview(game models.Game, record *models.GameRecord, moves []models.Move, ownerID int, title string) (models.Review, error) {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return models.Review{}, err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			log.Printf("Failed to roll back review: %v", err)
+		}
+	}()
+
+	review := models.Review{GameID: game.ID, OwnerID: ownerID, Title: title}
+	err = tx.QueryRow(
+		"INSERT INTO reviews (game_id, owner_id, title) VALUES ($1, $2, $3) RETURNING id, created_at, updated_at",
+		game.ID, ownerID, title,
+	).Scan(&review.ID, &review.CreatedAt, &review.UpdatedAt)
+	if err != nil {
+		return models.Review{}, err
+	}
+
+	root := models.ReviewNode{ReviewID: review.ID, X: -1, Y: -1}
+	if err := insertReviewNode(tx, &root); err != nil {
+		return models.Review{}, err
+	}
+	review.Nodes = append(review.Nodes, root)
+
+	board := rules.NewBoard(game.BoardSize)
+	if record != nil {
+		setupBoard(board, record)
+	}
+	parent := root
+	for _, m := range moves {
+		if !replayMove(board, game, m) {
+			continue
+		}
+		parentID := parent.ID
+		node := models.ReviewNode{
+			ReviewID:   review.ID,
+			ParentID:   &parentID,
+			MoveNumber: parent.MoveNumber + 1,
+			Color:      moveColor(game, m).String(),
+			X:          m.X,
+			Y:          m.Y,
+			Pass:       m.Pass,
+		}
+		if node.Pass {
+			node.X, node.Y = -1, -1
+		}
+		if err := insertReviewNode(tx, &node); err != nil {
+			return models.Review{}, err
+		}
+		review.Nodes = append(review.Nodes, node)
+		parent = node
+	}
+
+	// Viewers start at the beginning of the game
+	if _, err := tx.Exec("UPDATE reviews SET current_node_id = $1 WHERE id = $2", root.ID, review.ID); err != nil {
+		return models.Review{}, err
+	}
+	review.CurrentNodeID = &root.ID
+
+	if err := tx.Commit(); err != nil {
+		return models.Review{}, err
+	}
+	return review, nil
+}
+
+// ListGameReviews returns the reviews of a game, without their trees.
+func (h *Handler) ListGameReviews(w http.ResponseWriter, r *http.Request) {
+	gameID := chi.URLParam(r, "gameID")
+	id, err := strconv.Atoi(gameID)
+	if err != nil {
+		http.Error(w, "Invalid game ID", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := h.db.Query(
+		"SELECT id, game_id, owner_id, title, current_node_id, created_at, updated_at FROM reviews WHERE game_id = $1 ORDER BY created_at",
+		id,
+	)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Failed to close rows: %v", err)
+		}
+	}()
+
+	var reviews []models.Review
+	for rows.Next() {
+		var review models.Review
+		if err := rows.Scan(&review.ID, &review.GameID, &review.OwnerID, &review.Title, &review.CurrentNodeID, &review.CreatedAt, &review.UpdatedAt); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		reviews = append(reviews, review)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(reviews); err != nil {
+		log.Printf("Failed to encode reviews response: %v", err)
+	}
+}
+
+// GetReview returns a review with its whole tree.
+func (h *Handler) GetReview(w http.ResponseWriter, r *http.Request) {
+	review, ok := h.loadReview(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(review); err != nil {
+		log.Printf("Failed to encode review response: %v", err)
+	}
+}
+
+// GetReviewSGF returns a review as an SGF file, its variations and comments
+// included.
+func (h *Handler) GetReviewSGF(w http.ResponseWriter, r *http.Request) {
+	review, ok := h.loadReview(w, r)
+	if !ok {
+		return
+	}
+
+	game, err := h.getGame(review.GameID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	record, err := h.sgfRecord(game)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-go-sgf; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("frogs-cafe-%d-review-%d.sgf", game.ID, review.ID)))
+	if err := sgf.Encode(w, reviewRecord(game, record, review.Nodes)); err != nil {
+		log.Printf("Failed to write SGF for review %d: %v", review.ID, err)
+	}
+}
+
+// reviewRecord builds the SGF tree of a review: the game information of
+// the reviewed game, then every node of the review with its comment.
+// Moves that SGF cannot address are left out with everything below them.
+func reviewRecord(game models.Game, record *models.GameRecord, nodes []models.ReviewNode) *sgf.Node {
+	root := gameRoot(game, record)
+	children := make(map[int][]models.ReviewNode)
+	var top *models.ReviewNode
+	for i, node := range nodes {
+		if node.ParentID == nil {
+			top = &nodes[i]
+			continue
+		}
+		children[*node.ParentID] = append(children[*node.ParentID], node)
+	}
+	if top == nil {
+		return root
+	}
+
+	var add func(parent *sgf.Node, node models.ReviewNode)
+	add = func(parent *sgf.Node, node models.ReviewNode) {
+		if node.Comment != "" {
+			parent.Add("C", node.Comment)
+		}
+		for _, child := range children[node.ID] {
+			if !child.Pass && !sgfOnBoard(game, rules.Point{X: child.X, Y: child.Y}) {
+				log.Printf("Review #%d node %d cannot be exported, skipping", child.ReviewID, child.ID)
+				continue
+			}
+			add(parent.AddChild(sgfMove(rules.ParseColor(child.Color), child.X, child.Y, child.Pass)), child)
+		}
+	}
+	add(root, *top)
+	return root
+}
+
+// AddReviewNode adds a move or pass below parent_id. The move must be legal
+// in the position at the parent; if the parent already has the same move
+// as a child, that node is returned instead of adding another.
+func (h *Handler) AddReviewNode(w http.ResponseWriter, r *http.Request) {
+	playerID, ok := middleware.GetPlayerID(r)
+	if !ok {
+		http.Error(w, "Unauthorized: Player ID not found", http.StatusUnauthorized)
+		return
+	}
+	reviewID, ok := reviewIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.AddReviewNodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	color := rules.ParseColor(req.Color)
+	if req.Color != "" && color == rules.Empty {
+		http.Error(w, `Color must be "black" or "white"`, http.StatusBadRequest)
+		return
+	}
+	if utf8.RuneCountInString(req.Comment) > maxReviewCommentLength {
+		http.Error(w, fmt.Sprintf("Comment must be at most %d characters", maxReviewCommentLength), http.StatusBadRequest)
+		return
+	}
+
+	node, created, err := h.addReviewNode(reviewID, playerID, req, color)
+	if err != nil {
+		writeReviewError(w, err)
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		broadcastReview(reviewID, models.MsgReviewNodeAdded, node)
+		status = http.StatusCreated
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(node); err != nil {
+		log.Printf("Failed to encode review node response: %v", err)
+	}
+}
+
+// addReviewNode validates and stores a new node in one transaction, with
+// the review locked so that the owner's changes apply one at a time. color
+// is Empty to let the player to move play. It reports whether the node is
+// new.
+func (h *Handler) addReviewNode(reviewID, playerID int, req models.AddReviewNodeRequest, color rules.Color) (models.ReviewNode, bool, error) {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return models.ReviewNode{}, false, err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			log.Printf("Failed to roll back review node: %v", err)
+		}
+	}()
+
+	review, err := lockReview(tx, reviewID, playerID)
+	if err != nil {
+		return models.ReviewNode{}, false, err
+	}
+	nodes, err := queryReviewNodes(tx, reviewID)
+	if err != nil {
+		return models.ReviewNode{}, false, err
+	}
+	path := reviewPath(nodes, req.ParentID)
+	if path == nil {
+		return models.ReviewNode{}, false, &reviewError{http.StatusNotFound, "Parent node not found"}
+	}
+	parent := path[len(path)-1]
+
+	board, err := h.reviewBoard(review.GameID, path)
+	if err != nil {
+		return models.ReviewNode{}, false, err
+	}
+	if color == rules.Empty {
+		color = board.Next()
+	}
+
+	node := models.ReviewNode{
+		ReviewID:   reviewID,
+		ParentID:   &parent.ID,
+		MoveNumber: parent.MoveNumber + 1,
+		Color:      color.String(),
+		X:          req.X,
+		Y:          req.Y,
+		Pass:       req.Pass,
+		Comment:    req.Comment,
+	}
+	if node.Pass {
+		node.X, node.Y = -1, -1
+	}
+
+	for _, sibling := range nodes {
+		if sibling.ParentID != nil && *sibling.ParentID == parent.ID &&
+			sibling.Color == node.Color && sibling.Pass == node.Pass && sibling.X == node.X && sibling.Y == node.Y {
+			return sibling, false, nil
+		}
+	}
+
+	board.SetNext(color)
+	if node.Pass {
+		err = board.Pass(color)
+	} else {
+		_, err = board.Play(color, node.X, node.Y)
+	}
+	if err != nil {
+		return models.ReviewNode{}, false, &reviewError{http.StatusUnprocessableEntity, "Illegal move: " + err.Error()}
+	}
+
+	if err := insertReviewNode(tx, &node); err != nil {
+		return models.ReviewNode{}, false, err
+	}
+	if err := touchReview(tx, reviewID); err != nil {
+		return models.ReviewNode{}, false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return models.ReviewNode{}, false, err
+	}
+	return node, true, nil
+}
+
+// UpdateReviewNode replaces the comment on a node.
+func (h *Handler) UpdateReviewNode(w http.ResponseWriter, r *http.Request) {
+	playerID, ok := middleware.GetPlayerID(r)
+	if !ok {
+		http.Error(w, "Unauthorized: Player ID not found", http.StatusUnauthorized)
+		return
+	}
+	reviewID, ok := reviewIDParam(w, r)
+	if !ok {
+		return
+	}
+	nodeID, err := strconv.Atoi(chi.URLParam(r, "nodeID"))
+	if err != nil {
+		http.Error(w, "Invalid node ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.UpdateReviewNodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if utf8.RuneCountInString(req.Comment) > maxReviewCommentLength {
+		http.Error(w, fmt.Sprintf("Comment must be at most %d characters", maxReviewCommentLength), http.StatusBadRequest)
+		return
+	}
+
+	node, err := h.updateReviewNode(reviewID, playerID, nodeID, req.Comment)
+	if err != nil {
+		writeReviewError(w, err)
+		return
+	}
+	broadcastReview(reviewID, models.MsgReviewNodeUpdated, node)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(node); err != nil {
+		log.Printf("Failed to encode review node response: %v", err)
+	}
+}
+
+func (h *Handler) updateReviewNode(reviewID, playerID, nodeID int, comment string) (models.ReviewNode, error) {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return models.ReviewNode{}, err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			log.Printf("Failed to roll back review node: %v", err)
+		}
+	}()
+
+	if _, err := lockReview(tx, reviewID, playerID); err != nil {
+		return models.ReviewNode{}, err
+	}
+
+	var node models.ReviewNode
+	err = tx.QueryRow(
+		`UPDATE review_nodes SET comment = $1 WHERE id = $2 AND review_id = $3
+		RETURNING id, review_id, parent_id, move_number, color, x, y, is_pass, comment, created_at`,
+		comment, nodeID, reviewID,
+	).Scan(&node.ID, &node.ReviewID, &node.ParentID, &node.MoveNumber, &node.Color, &node.X, &node.Y, &node.Pass, &node.Comment, &node.CreatedAt)
+	if err == sql.ErrNoRows {
+		return models.ReviewNode{}, &reviewError{http.StatusNotFound, "Node not found"}
+	}
+	if err != nil {
+		return models.ReviewNode{}, err
+	}
+	if err := touchReview(tx, reviewID); err != nil {
+		return models.ReviewNode{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return models.ReviewNode{}, err
+	}
+	return node, nil
+}
+
+// DeleteReviewNode removes a branch: a node and everything below it. The
+// root cannot be removed. If the owner was showing a removed node, viewers
+// are moved to the branch's parent.
+func (h *Handler) DeleteReviewNode(w http.ResponseWriter, r *http.Request) {
+	playerID, ok := middleware.GetPlayerID(r)
+	if !ok {
+		http.Error(w, "Unauthorized: Player ID not found", http.StatusUnauthorized)
+		return
+	}
+	reviewID, ok := reviewIDParam(w, r)
+	if !ok {
+		return
+	}
+	nodeID, err := strconv.Atoi(chi.URLParam(r, "nodeID"))
+	if err != nil {
+		http.Error(w, "Invalid node ID", http.StatusBadRequest)
+		return
+	}
+
+	current, moved, err := h.deleteReviewNode(reviewID, playerID, nodeID)
+	if err != nil {
+		writeReviewError(w, err)
+		return
+	}
+	broadcastReview(reviewID, models.MsgReviewNodeRemoved, models.ReviewNodeRemovedData{ReviewID: reviewID, NodeID: nodeID})
+	if moved {
+		broadcastReview(reviewID, models.MsgReviewCurrent, models.ReviewCurrentData{ReviewID: reviewID, NodeID: current})
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deleteReviewNode removes nodeID and its descendants. It returns the node
+// the review now shows and whether that changed.
+func (h *Handler) deleteReviewNode(reviewID, playerID, nodeID int) (int, bool, error) {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return 0, false, err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			log.Printf("Failed to roll back review node: %v", err)
+		}
+	}()
+
+	review, err := lockReview(tx, reviewID, playerID)
+	if err != nil {
+		return 0, false, err
+	}
+	nodes, err := queryReviewNodes(tx, reviewID)
+	if err != nil {
+		return 0, false, err
+	}
+	path := reviewPath(nodes, nodeID)
+	if path == nil {
+		return 0, false, &reviewError{http.StatusNotFound, "Node not found"}
+	}
+	node := path[len(path)-1]
+	if node.ParentID == nil {
+		return 0, false, &reviewError{http.StatusBadRequest, "The root node cannot be removed"}
+	}
+
+	// Move viewers off the branch before it goes
+	current, moved := 0, false
+	if review.CurrentNodeID != nil {
+		current = *review.CurrentNodeID
+		onBranch := slices.ContainsFunc(reviewPath(nodes, current), func(n models.ReviewNode) bool {
+			return n.ID == nodeID
+		})
+		if onBranch {
+			current, moved = *node.ParentID, true
+			if _, err := tx.Exec("UPDATE reviews SET current_node_id = $1 WHERE id = $2", current, reviewID); err != nil {
+				return 0, false, err
+			}
+		}
+	}
+
+	if _, err := tx.Exec("DELETE FROM review_nodes WHERE id = $1", nodeID); err != nil {
+		return 0, false, err
+	}
+	if err := touchReview(tx, reviewID); err != nil {
+		return 0, false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, false, err
+	}
+	return current, moved, nil
+}
+
+// SetReviewCurrent moves the owner to a node; everyone following the review
+// is told to show it.
+func (h *Handler) SetReviewCurrent(w http.ResponseWriter, r *http.Request) {
+	playerID, ok := middleware.GetPlayerID(r)
+	if !ok {
+		http.Error(w, "Unauthorized: Player ID not found", http.StatusUnauthorized)
+		return
+	}
+	reviewID, ok := reviewIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.SetReviewCurrentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.setReviewCurrent(reviewID, playerID, req.NodeID); err != nil {
+		writeReviewError(w, err)
+		return
+	}
+	current := models.ReviewCurrentData{ReviewID: reviewID, NodeID: req.NodeID}
+	broadcastReview(reviewID, models.MsgReviewCurrent, current)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(current); err != nil {
+		log.Printf("Failed to encode review response: %v", err)
+	}
+}
+
+func (h *Handler) setReviewCurrent(reviewID, playerID, nodeID int) error {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			log.Printf("Failed to roll back review: %v", err)
+		}
+	}()
+
+	if _, err := lockReview(tx, reviewID, playerID); err != nil {
+		return err
+	}
+	result, err := tx.Exec(
+		"UPDATE reviews SET current_node_id = $1 WHERE id = $2 AND EXISTS (SELECT 1 FROM review_nodes WHERE id = $1 AND review_id = $2)",
+		nodeID, reviewID,
+	)
+	if err != nil {
+		return err
+	}
+	if count, err := result.RowsAffected(); err != nil {
+		return err
+	} else if count == 0 {
+		return &reviewError{http.StatusNotFound, "Node not found"}
+	}
+	return tx.Commit()
+}
+
+// broadcastReview tells everyone following a review about a change.
+func broadcastReview(reviewID int, msgType string, data interface{}) {
+	message, err := encodeMessage(msgType, data)
+	if err != nil {
+		log.Printf("Failed to marshal %s message: %v", msgType, err)
+		return
+	}
+	hub.Broadcast(reviewChannel(reviewID), message)
+}
+
+// reviewIDParam parses the review ID in the URL, answering 400 if it is not
+// a number.
+func reviewIDParam(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "reviewID"))
+	if err != nil {
+		http.Error(w, "Invalid review ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// loadReview loads the review named in the URL with its nodes, answering
+// the request itself if that fails.
+func (h *Handler) loadReview(w http.ResponseWriter, r *http.Request) (models.Review, bool) {
+	id, ok := reviewIDParam(w, r)
+	if !ok {
+		return models.Review{}, false
+	}
+
+	review, err := h.getReview(id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Review not found", http.StatusNotFound)
+		return models.Review{}, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return models.Review{}, false
+	}
+	return review, true
+}
+
+// getReview loads a review with its nodes.
+func (h *Handler) getReview(id int) (models.Review, error) {
+	review, err := queryReview(h.db, "SELECT id, game_id, owner_id, title, current_node_id, created_at, updated_at FROM reviews WHERE id = $1", id)
+	if err != nil {
+		return models.Review{}, err
+	}
+	review.Nodes, err = queryReviewNodes(h.db, id)
+	return review, err
+}
+
+// lockReview locks a review for the rest of tx, refusing players other than
+// its owner.
+func lockReview(tx *sql.Tx, reviewID, playerID int) (models.Review, error) {
+	review, err := queryReview(tx, "SELECT id, game_id, owner_id, title, current_node_id, created_at, updated_at FROM reviews WHERE id = $1 FOR UPDATE", reviewID)
+	if err == sql.ErrNoRows {
+		return models.Review{}, &reviewError{http.StatusNotFound, "Review not found"}
+	}
+	if err != nil {
+		return models.Review{}, err
+	}
+	if review.OwnerID != playerID {
+		return models.Review{}, &reviewError{http.StatusForbidden, "Only the owner can change a review"}
+	}
+	return review, nil
+}
+
+func queryReview(q querier, query string, id int) (models.Review, error) {
+	var review models.Review
+	err := q.QueryRow(query, id).Scan(&review.ID, &review.GameID, &review.OwnerID, &review.Title, &review.CurrentNodeID, &review.CreatedAt, &review.UpdatedAt)
+	return review, err
+}
+
+// queryReviewNodes returns the nodes of a review in the order they were
+// added, so parents come before their children.
+func queryReviewNodes(q querier, reviewID int) ([]models.ReviewNode, error) {
+	rows, err := q.Query(
+		"SELECT id, review_id, parent_id, move_number, color, x, y, is_pass, comment, created_at FROM review_nodes WHERE review_id = $1 ORDER BY id",
+		reviewID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Failed to close rows: %v", err)
+		}
+	}()
+
+	var nodes []models.ReviewNode
+	for rows.Next() {
+		var node models.ReviewNode
+		if err := rows.Scan(&node.ID, &node.ReviewID, &node.ParentID, &node.MoveNumber, &node.Color, &node.X, &node.Y, &node.Pass, &node.Comment, &node.CreatedAt); err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, rows.Err()
+}
+
+func insertReviewNode(tx *sql.Tx, node *models.ReviewNode) error {
+	return tx.QueryRow(
+		`INSERT INTO review_nodes (review_id, parent_id, move_number, color, x, y, is_pass, comment)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id, created_at`,
+		node.ReviewID, node.ParentID, node.MoveNumber, node.Color, node.X, node.Y, node.Pass, node.Comment,
+	).Scan(&node.ID, &node.CreatedAt)
+}
+
+func touchReview(tx *sql.Tx, reviewID int) error {
+	_, err := tx.Exec("UPDATE reviews SET updated_at = CURRENT_TIMESTAMP WHERE id = $1", reviewID)
+	return err
+}
+
+// reviewPath returns the nodes from the root down to nodeID, or nil if the
+// review has no such node.
+func reviewPath(nodes []models.ReviewNode, nodeID int) []models.ReviewNode {
+	byID := make(map[int]models.ReviewNode, len(nodes))
+	for _, node := range nodes {
+		byID[node.ID] = node
+	}
+
+	var path []models.ReviewNode
+	for id := nodeID; ; {
+		node, ok := byID[id]
+		if !ok || len(path) > len(nodes) {
+			return nil
+		}
+		path = append(path, node)
+		if node.ParentID == nil {
+			break
+		}
+		id = *node.ParentID
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+// reviewBoard plays the moves along path, which starts at the root, from
+// the reviewed game's starting position.
+func (h *Handler) reviewBoard(gameID int, path []models.ReviewNode) (*rules.Board, error) {
+	game, err := h.getGame(gameID)
+	if err != nil {
+		return nil, err
+	}
+	record, err := h.getGameRecord(gameID)
+	if err != nil {
+		return nil, err
+	}
+
+	board := rules.NewBoard(game.BoardSize)
+	if record != nil {
+		setupBoard(board, record)
+	}
+	for _, node := range path[1:] {
+		color := rules.ParseColor(node.Color)
+		board.SetNext(color)
+		if node.Pass {
+			err = board.Pass(color)
+		} else {
+			_, err = board.Play(color, node.X, node.Y)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("review #%d node %d: %w", node.ReviewID, node.ID, err)
+		}
+	}
+	return board, nil
+}
@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"frogs_cafe/models"
+	"frogs_cafe/rules"
+	"frogs_cafe/sgf"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// GetGameSGF returns a game as an SGF file for review in external editors.
+func (h *Handler) GetGameSGF(w http.ResponseWriter, r *http.Request) {
+	gameID := chi.URLParam(r, "gameID")
+	id, err := strconv.Atoi(gameID)
+	if err != nil {
+		http.Error(w, "Invalid game ID", http.StatusBadRequest)
+		return
+	}
+
+	game, err := h.getGame(id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Game not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	record, err := h.gameSGF(game)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-go-sgf; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", sgfFilename(id)))
+	if err := sgf.Encode(w, record); err != nil {
+		log.Printf("Failed to write SGF for game %d: %v", id, err)
+	}
+}
+
+func sgfFilename(gameID int) string {
+	return fmt.Sprintf("frogs-cafe-%d.sgf", gameID)
+}
+
+// gameSGF loads the moves and record of game and builds its SGF tree.
+func (h *Handler) gameSGF(game models.Game) (*sgf.Node, error) {
+	moves, err := h.getMoves(game.ID)
+	if err != nil {
+		return nil, err
+	}
+	annotations, err := h.getAnnotations(game.ID)
+	if err != nil {
+		return nil, err
+	}
+	attachAnnotations(moves, annotations)
+
+	record, err := h.sgfRecord(game)
+	if err != nil {
+		return nil, err
+	}
+	return gameRecord(game, record, moves), nil
+}
+
+// sgfRecord returns the game information to export for game: the stored
+// record of an imported game, or one naming the players of a game played
+// here.
+func (h *Handler) sgfRecord(game models.Game) (*models.GameRecord, error) {
+	record, err := h.getGameRecord(game.ID)
+	if err != nil || record != nil {
+		return record, err
+	}
+
+	// Games played here are known by their players' usernames. BR and WR are
+	// left out: ratings stay at their starting value, as nothing updates
+	// them yet, so a rank derived from one would say nothing about the player
+	record = &models.GameRecord{GameID: game.ID}
+	if record.BlackName, err = h.playerName(game.BlackPlayerID); err != nil {
+		return nil, err
+	}
+	if record.WhiteName, err = h.playerName(game.WhitePlayerID); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// playerName returns the username of id, or "" for a seat nobody took.
+func (h *Handler) playerName(id *int) (string, error) {
+	if id == nil {
+		return "", nil
+	}
+	var username string
+	err := h.db.QueryRow("SELECT username FROM players WHERE id = $1", *id).Scan(&username)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return username, err
+}
+
+// gameRecord builds the SGF tree of a game: a root node with the game
+// information and setup stones, followed by one node per move with any
+// annotations attached to it.
+func gameRecord(game models.Game, record *models.GameRecord, moves []models.Move) *sgf.Node {
+	root := gameRoot(game, record)
+	node := root
+	for _, m := range moves {
+		color := moveColor(game, m)
+		if color == rules.Empty || (!m.Pass && !sgfOnBoard(game, rules.Point{X: m.X, Y: m.Y})) {
+			log.Printf("Game #%d move %d cannot be exported, skipping", game.ID, m.MoveNumber)
+			continue
+		}
+		node = node.AddChild(sgfMove(color, m.X, m.Y, m.Pass))
+		addAnnotations(node, game, m.Annotations)
+	}
+	return root
+}
+
+// gameRoot builds the root node of a game's SGF tree: the game information
+// and setup stones.
+func gameRoot(game models.Game, record *models.GameRecord) *sgf.Node {
+	root := &sgf.Node{}
+	root.Add("FF", "4")
+	root.Add("GM", "1")
+	root.Add("CA", "UTF-8")
+	root.Add("AP", "Frogs Café")
+	root.Add("SZ", strconv.Itoa(game.BoardSize))
+
+	// Imported games keep the information of the file they came from
+	name, place, date := record.Name, record.Place, record.Date
+	if game.Status != "imported" {
+		name = fmt.Sprintf("Frogs Café game #%d", game.ID)
+		place = "Frogs Café"
+		date = game.CreatedAt.Format("2006-01-02")
+	}
+	addText := func(id, value string) {
+		if value != "" {
+			root.Add(id, value)
+		}
+	}
+	addText("GN", name)
+	addText("EV", record.Event)
+	addText("PC", place)
+	addText("DT", date)
+	addText("PB", record.BlackName)
+	addText("BR", record.BlackRank)
+	addText("PW", record.WhiteName)
+	addText("WR", record.WhiteRank)
+	addText("RU", record.Rules)
+	if record.Komi != nil {
+		root.Add("KM", strconv.FormatFloat(*record.Komi, 'f', -1, 64))
+	}
+	if record.Handicap > 0 {
+		root.Add("HA", strconv.Itoa(record.Handicap))
+	}
+	if record.MainTime != nil {
+		root.Add("TM", strconv.FormatFloat(*record.MainTime, 'f', -1, 64))
+	}
+	addText("OT", record.Overtime)
+	if record.Result != "" {
+		root.Add("RE", record.Result)
+	} else if result := gameResult(game); result != "" {
+		root.Add("RE", result)
+	}
+
+	for _, setup := range []struct {
+		id     string
+		points []rules.Point
+	}{{"AB", record.SetupBlack}, {"AW", record.SetupWhite}} {
+		for _, p := range setup.points {
+			if sgfOnBoard(game, p) {
+				root.Add(setup.id, sgf.Point(p.X, p.Y))
+			}
+		}
+	}
+	if record.FirstPlayer != "" {
+		root.Add("PL", sgfColor(rules.ParseColor(record.FirstPlayer)))
+	}
+	return root
+}
+
+// sgfOnBoard reports whether p is on game's board and can be written in
+// SGF, which cannot address lines beyond the 52nd.
+func sgfOnBoard(game models.Game, p rules.Point) bool {
+	size := min(game.BoardSize, sgf.MaxBoardSize)
+	return p.X >= 0 && p.Y >= 0 && p.X < size && p.Y < size
+}
+
+// sgfMove returns a node holding a move or pass by color.
+func sgfMove(color rules.Color, x, y int, pass bool) *sgf.Node {
+	node := &sgf.Node{}
+	if pass {
+		node.Add(sgfColor(color), "")
+	} else {
+		node.Add(sgfColor(color), sgf.Point(x, y))
+	}
+	return node
+}
+
+// gameResult returns the RE value for a game, or "" while it is undecided.
+// Games do not record a margin, so wins are given without one.
+func gameResult(game models.Game) string {
+	switch game.Status {
+	case "cancelled":
+		return "Void"
+	case "finished":
+		if game.WinnerID == nil {
+			return "?"
+		}
+		switch playerColor(game, *game.WinnerID) {
+		case rules.Black:
+			return "B+"
+		case rules.White:
+			return "W+"
+		}
+		return "?"
+	}
+	return ""
+}
+
+// sgfColor returns the SGF property for a move by color.
+func sgfColor(c rules.Color) string {
+	if c == rules.White {
+		return "W"
+	}
+	return "B"
+}
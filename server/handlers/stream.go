@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"frogs_cafe/models"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// longPollTimeout is how long a poll waits for an event before returning
+// empty-handed; it stays below common proxy idle timeouts.
+const longPollTimeout = 25 * time.Second
+
+// streamClient registers a hub client for an HTTP event stream of one game.
+// It has no connection of its own: the caller drains send and must
+// unregister it when the request ends. With a known epoch the client
+// resumes after lastSeq; otherwise it subscribes and gets a game_state.
+func streamClient(gameID int, epoch string, lastSeq int64) *Client {
+	client := &Client{
+		send:     make(chan []byte, 256),
+		channels: make(map[string]bool),
+		pending:  make(map[string][][]byte),
+		userID:   "guest",
+	}
+
+	hub.register <- client
+	if epoch != "" {
+		hub.resume <- resumeRequest{client: client, gameID: gameID, lastSeq: lastSeq, epoch: epoch}
+	} else {
+		hub.subscribe <- subscription{client: client, channel: gameChannel(gameID)}
+	}
+	return client
+}
+
+// parseEventID splits an SSE event ID of the form "<epoch>:<seq>".
+func parseEventID(id string) (string, int64, bool) {
+	epoch, seqText, found := strings.Cut(id, ":")
+	if !found || epoch == "" {
+		return "", 0, false
+	}
+	seq, err := strconv.ParseInt(seqText, 10, 64)
+	if err != nil || seq < 0 {
+		return "", 0, false
+	}
+	return epoch, seq, true
+}
+
+// eventSeq returns the type of message and the sequence number it brings
+// its reader up to: the seq of a game event, or the seq a game_state
+// snapshot reflects. ok is false for messages outside the sequence.
+func eventSeq(message []byte) (msgType string, seq int64, ok bool) {
+	var header struct {
+		Type string `json:"type"`
+		Seq  int64  `json:"seq"`
+		Data struct {
+			Seq int64 `json:"seq"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(message, &header); err != nil {
+		return "", 0, false
+	}
+	if header.Type == models.MsgGameState {
+		return header.Type, header.Data.Seq, true
+	}
+	return header.Type, header.Seq, header.Seq > 0
+}
+
+// GameEvents streams a game's events as Server-Sent Events, for clients
+// whose network breaks WebSockets. Each message is the JSON a WebSocket
+// client would receive. Game events carry an ID of "<epoch>:<seq>", so a
+// reconnecting EventSource resumes through Last-Event-ID.
+func (h *Handler) GameEvents(w http.ResponseWriter, r *http.Request) {
+	gameID := chi.URLParam(r, "gameID")
+	id, err := strconv.Atoi(gameID)
+	if err != nil {
+		http.Error(w, "Invalid game ID", http.StatusBadRequest)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	epoch, lastSeq, _ := parseEventID(r.Header.Get("Last-Event-ID"))
+	client := streamClient(id, epoch, lastSeq)
+	defer func() {
+		hub.unregister <- client
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	// A comment now and then keeps proxies from closing an idle stream
+	keepAlive := time.NewTicker(h.cfg.WSPingPeriod())
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+
+		case message, ok := <-client.send:
+			if !ok {
+				// Dropped by the hub for falling behind
+				return
+			}
+			if err := writeEvent(w, message); err != nil {
+				log.Printf("Failed to write event for game %d: %v", id, err)
+				return
+			}
+			flusher.Flush()
+
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, message []byte) error {
+	if _, seq, ok := eventSeq(message); ok {
+		if _, err := fmt.Fprintf(w, "id: %s:%d\n", hub.epoch, seq); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "data: %s\n\n", message)
+	return err
+}
+
+// PollGameEvents is the long-poll variant of GameEvents. Without epoch it
+// returns a game_state at once; with ?epoch=&after=<seq> it waits until an
+// event after seq is published or the poll times out, and returns every
+// message delivered by then. Clients poll again with the epoch returned and
+// the seq of the last event they saw.
+func (h *Handler) PollGameEvents(w http.ResponseWriter, r *http.Request) {
+	gameID := chi.URLParam(r, "gameID")
+	id, err := strconv.Atoi(gameID)
+	if err != nil {
+		http.Error(w, "Invalid game ID", http.StatusBadRequest)
+		return
+	}
+
+	epoch := r.URL.Query().Get("epoch")
+	var after int64
+	if epoch != "" {
+		after, err = strconv.ParseInt(r.URL.Query().Get("after"), 10, 64)
+		if err != nil || after < 0 {
+			http.Error(w, "Invalid after", http.StatusBadRequest)
+			return
+		}
+	}
+
+	client := streamClient(id, epoch, after)
+	defer func() {
+		hub.unregister <- client
+	}()
+
+	response := models.EventPollData{Epoch: hub.epoch, Messages: []json.RawMessage{}}
+	timeout := time.NewTimer(longPollTimeout)
+	defer timeout.Stop()
+
+wait:
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+
+		case <-timeout.C:
+			break wait
+
+		case message, ok := <-client.send:
+			if !ok {
+				break wait
+			}
+			response.Messages = append(response.Messages, message)
+			if msgType, _, ok := eventSeq(message); ok || msgType == models.MsgError {
+				// Whatever the hub queued alongside goes out in the same reply
+				response.Messages = append(response.Messages, drain(client.send)...)
+				break wait
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Failed to encode poll response: %v", err)
+	}
+}
+
+// drain returns every message already waiting in send without blocking.
+func drain(send chan []byte) []json.RawMessage {
+	var messages []json.RawMessage
+	for {
+		select {
+		case message, ok := <-send:
+			if !ok {
+				return messages
+			}
+			messages = append(messages, message)
+		default:
+			return messages
+		}
+	}
+}
@@ -1,112 +1,72 @@
 package handlers
 
 import (
-	"encoding/json"
-	"fmt"
+	"errors"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"frogs_cafe/auth"
+	"frogs_cafe/config"
+	"frogs_cafe/models"
 
 	"github.com/gorilla/websocket"
 )
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		// Allow all origins in development - restrict in production
-		return true
-	},
-}
-
-type Client struct {
-	conn     *websocket.Conn
-	send     chan []byte
-	gameID   string
-	userID   string
-	playerID int
-}
-
-type Hub struct {
-	clients    map[*Client]bool
-	broadcast  chan []byte
-	register   chan *Client
-	unregister chan *Client
-	mutex      sync.RWMutex
-	handler    *Handler
+func newUpgrader(cfg *config.Config) *websocket.Upgrader {
+	return &websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		CheckOrigin: func(r *http.Request) bool {
+			return checkOrigin(cfg, r)
+		},
+	}
 }
 
-var hub *Hub
+// checkOrigin guards against cross-site WebSocket hijacking: a page on
+// another site must not be able to open a socket on behalf of our users.
+// Requests without an Origin header come from non-browser clients.
+func checkOrigin(cfg *config.Config, r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
 
-func InitHub(h *Handler) {
-	hub = &Hub{
-		clients:    make(map[*Client]bool),
-		broadcast:  make(chan []byte),
-		register:   make(chan *Client),
-		unregister: make(chan *Client),
-		handler:    h,
+	u, err := url.Parse(origin)
+	if err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
 	}
-	go hub.run()
-}
 
-func GetHub() *Hub {
-	return hub
+	if cfg.IsOriginAllowed(origin) {
+		return true
+	}
+	log.Printf("Rejected WebSocket from origin %q", origin)
+	return false
 }
 
-func (h *Hub) run() {
-	for {
-		select {
-		case client := <-h.register:
-			h.mutex.Lock()
-			h.clients[client] = true
-			h.mutex.Unlock()
-			log.Printf("Client registered: %s", client.userID)
-
-		case client := <-h.unregister:
-			h.mutex.Lock()
-			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				close(client.send)
-				log.Printf("Client unregistered: %s", client.userID)
-			}
-			h.mutex.Unlock()
-
-		case message := <-h.broadcast:
-			h.mutex.RLock()
-			// Parse message to log type and determine target game
-			var msgData map[string]interface{}
-			targetGameID := ""
-			msgType := "unknown"
-			if err := json.Unmarshal(message, &msgData); err == nil {
-				if t, ok := msgData["type"].(string); ok {
-					msgType = t
-				}
-				if data, ok := msgData["data"].(map[string]interface{}); ok {
-					if gid, ok := data["game_id"].(float64); ok {
-						targetGameID = fmt.Sprintf("%.0f", gid)
-					}
-				}
-			}
-
-			recipientCount := 0
-			for client := range h.clients {
-				// Only send to clients watching the target game (or broadcast if no game_id)
-				if targetGameID == "" || client.gameID == targetGameID {
-					select {
-					case client.send <- message:
-						recipientCount++
-					default:
-						close(client.send)
-						delete(h.clients, client)
-					}
-				}
-			}
-			log.Printf("Broadcast [%s] to %d clients (game=%s)", msgType, recipientCount, targetGameID)
-			h.mutex.RUnlock()
-		}
-	}
+type Client struct {
+	conn     *websocket.Conn
+	send     chan []byte
+	channels map[string]bool     // Owned by the hub goroutine once registered
+	pending  map[string][][]byte // Events held back until a snapshot is sent, by channel
+	remoteIP string
+	limits   connLimits // Only used from readPump
+
+	// Who the client is; authenticate changes it on the readPump goroutine
+	// while the hub and writePump read it
+	identityMutex sync.RWMutex
+	userID        string
+	playerID      int
+
+	// Set by the hub before it closes send, so writePump can tell the
+	// client why it was dropped
+	closeCode   int
+	closeReason string
 }
 
 func (h *Handler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
@@ -139,21 +99,69 @@ func (h *Handler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 		username = "guest"
 	}
 
-	conn, err := upgrader.Upgrade(w, r, nil)
+	remoteIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remoteIP = r.RemoteAddr
+	}
+
+	// Refuse clients banned for flooding before upgrading
+	if until, banned := hub.limiter.bannedUntil(banKey(playerID, remoteIP)); banned {
+		w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(until).Seconds())+1))
+		http.Error(w, "Temporarily banned for flooding", http.StatusTooManyRequests)
+		return
+	}
+
+	conn, err := h.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Printf("WebSocket upgrade error: %v", err)
 		return
 	}
 
+	// Browsers cannot read an HTTP error from a failed upgrade, so refuse
+	// unsupported protocol versions with a close code instead
+	protocolVersion, ok := negotiateProtocol(r.URL.Query().Get("protocol"))
+	if !ok {
+		log.Printf("Rejecting WebSocket with unsupported protocol %q", r.URL.Query().Get("protocol"))
+		closeMessage := websocket.FormatCloseMessage(models.CloseUnsupportedProtocol, "unsupported protocol version")
+		if err := conn.WriteMessage(websocket.CloseMessage, closeMessage); err != nil {
+			log.Printf("Failed to send close message: %v", err)
+		}
+		if err := conn.Close(); err != nil {
+			log.Printf("Failed to close connection: %v", err)
+		}
+		return
+	}
+
+	// The lobby can be joined from the query string; games are subscribed
+	// through the hub below so the client gets their game_state
+	channels := make(map[string]bool)
+	if r.URL.Query().Get("lobby") == "true" {
+		channels[lobbyChannel] = true
+	}
+
 	client := &Client{
 		conn:     conn,
 		send:     make(chan []byte, 256),
-		gameID:   r.URL.Query().Get("game_id"),
+		channels: channels,
+		pending:  make(map[string][][]byte),
 		userID:   username,
 		playerID: playerID,
+		remoteIP: remoteIP,
+		limits:   connLimits{buckets: newBuckets(h.cfg, time.Now())},
 	}
 
+	// Queue hello before registering so it is always the first message
+	client.sendJSON(models.MsgHello, models.HelloData{
+		ProtocolVersion: protocolVersion,
+		Epoch:           hub.epoch,
+		PlayerID:        playerID,
+		Username:        username,
+	})
 	hub.register <- client
+	metrics.opened.Add(1)
+	if gameID, err := strconv.Atoi(r.URL.Query().Get("game_id")); err == nil && gameID > 0 {
+		hub.subscribe <- subscription{client: client, channel: gameChannel(gameID)}
+	}
 
 	go client.writePump()
 	go client.readPump()
@@ -165,114 +173,155 @@ func (c *Client) readPump() {
 		if err := c.conn.Close(); err != nil {
 			log.Printf("Failed to close connection: %v", err)
 		}
+		metrics.closed.Add(1)
 	}()
 
+	cfg := hub.handler.cfg
+	c.conn.SetReadLimit(cfg.WSMaxMessageSize)
+	if err := c.conn.SetReadDeadline(time.Now().Add(cfg.WSPongWait)); err != nil {
+		log.Printf("Failed to set read deadline: %v", err)
+		return
+	}
+	// Every pong proves the peer is alive and pushes the deadline out
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(cfg.WSPongWait))
+	})
+
 	for {
 		_, message, err := c.conn.ReadMessage()
 		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("WebSocket error: %v", err)
-			}
+			c.handleReadError(err)
 			break
 		}
 
-		// Process message (game move, chat, etc.)
-		var msg map[string]interface{}
-		if err := json.Unmarshal(message, &msg); err != nil {
-			log.Printf("JSON unmarshal error: %v", err)
-			continue
+		if !c.handleMessage(message) {
+			break
 		}
+	}
+}
 
-		log.Printf("Received message: %+v", msg)
-
-		// Handle authentication upgrade
-		if msgType, ok := msg["type"].(string); ok && msgType == "authenticate" {
-			if data, ok := msg["data"].(map[string]interface{}); ok {
-				if tokenStr, ok := data["token"].(string); ok {
-					// Validate the token
-					playerID, username, err := auth.ValidateSession(hub.handler.db.DB, tokenStr)
-					if err != nil {
-						log.Printf("Authentication upgrade failed: %v", err)
-						// Send error response back to client
-						response := map[string]interface{}{
-							"type": "auth_error",
-							"data": map[string]string{"error": "Invalid token"},
-						}
-						if respBytes, err := json.Marshal(response); err == nil {
-							c.send <- respBytes
-						}
-						continue
-					}
-
-					// Upgrade the client's credentials
-					c.playerID = playerID
-					c.userID = username
-					log.Printf("Client upgraded to authenticated user: %s (ID: %d)", username, playerID)
-
-					// Send success response
-					response := map[string]interface{}{
-						"type": "auth_success",
-						"data": map[string]interface{}{
-							"player_id": playerID,
-							"username":  username,
-						},
-					}
-					if respBytes, err := json.Marshal(response); err == nil {
-						c.send <- respBytes
-					}
-					continue
-				}
-			}
-		}
+// handleReadError records why a connection ended and, where the client
+// broke a limit, tells it with the matching close code.
+func (c *Client) handleReadError(err error) {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, websocket.ErrReadLimit):
+		metrics.messageTooBig.Add(1)
+		log.Printf("Closing connection for %s: message exceeds %d bytes", c.name(), hub.handler.cfg.WSMaxMessageSize)
+		c.closeWith(websocket.CloseMessageTooBig, "message too large")
+	case errors.As(err, &netErr) && netErr.Timeout():
+		metrics.pongTimeouts.Add(1)
+		log.Printf("Closing connection for %s: no pong received", c.name())
+		c.closeWith(websocket.ClosePolicyViolation, "heartbeat timeout")
+	case websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway):
+		metrics.unexpectedCloses.Add(1)
+		log.Printf("WebSocket error: %v", err)
+	}
+}
 
-		// Handle move type messages
-		if msgType, ok := msg["type"].(string); ok && msgType == "move" {
-			// Only authenticated players can make moves
-			if c.playerID == 0 {
-				log.Printf("Guest attempted to make a move - rejected")
-				continue
-			}
+// closeWith sends a close frame. It is safe to call concurrently with
+// writePump.
+func (c *Client) closeWith(code int, reason string) {
+	message := websocket.FormatCloseMessage(code, reason)
+	deadline := time.Now().Add(hub.handler.cfg.WSWriteWait)
+	if err := c.conn.WriteControl(websocket.CloseMessage, message, deadline); err != nil && !errors.Is(err, websocket.ErrCloseSent) {
+		log.Printf("Failed to send close message: %v", err)
+	}
+}
 
-			if data, ok := msg["data"].(map[string]interface{}); ok {
-				// Use authenticated playerID from JWT, not from message
-				if err := hub.handler.SaveMove(c.gameID, c.playerID, data); err != nil {
-					log.Printf("Error saving move: %v", err)
-					continue
-				}
+// identity returns the player the client is authenticated as, or 0 for a
+// guest, and their username.
+func (c *Client) identity() (int, string) {
+	c.identityMutex.RLock()
+	defer c.identityMutex.RUnlock()
+	return c.playerID, c.userID
+}
 
-				// Add the authenticated player_id to the data before broadcasting
-				data["player_id"] = float64(c.playerID) // JSON numbers are float64
-				msg["data"] = data
+// setIdentity records who the client has authenticated as.
+func (c *Client) setIdentity(playerID int, userID string) {
+	c.identityMutex.Lock()
+	defer c.identityMutex.Unlock()
+	c.playerID, c.userID = playerID, userID
+}
 
-				// Re-marshal the updated message
-				updatedMessage, err := json.Marshal(msg)
-				if err != nil {
-					log.Printf("Error marshaling updated message: %v", err)
-					continue
-				}
+// name returns the client's username, for logging.
+func (c *Client) name() string {
+	_, userID := c.identity()
+	return userID
+}
 
-				// Broadcast the updated message to all clients in the same game
-				hub.broadcast <- updatedMessage
-				continue
-			}
-		}
+// sendJSON queues a message for the client without blocking, dropping it if
+// the send buffer is full. Once the client is registered it must only be
+// called from the hub goroutine, which owns closing c.send.
+func (c *Client) sendJSON(msgType string, data interface{}) {
+	message, err := encodeMessage(msgType, data)
+	if err != nil {
+		log.Printf("Failed to marshal %s message: %v", msgType, err)
+		return
+	}
+	c.sendRaw(message)
+}
 
-		// For other message types, broadcast as-is
-		hub.broadcast <- message
+// sendRaw is sendJSON for an already encoded message.
+func (c *Client) sendRaw(message []byte) {
+	select {
+	case c.send <- message:
+	default:
+		log.Printf("Dropping message for %s: send buffer full", c.name())
 	}
 }
 
 func (c *Client) writePump() {
+	cfg := hub.handler.cfg
+	ticker := time.NewTicker(cfg.WSPingPeriod())
 	defer func() {
+		ticker.Stop()
 		if err := c.conn.Close(); err != nil {
 			log.Printf("Failed to close connection: %v", err)
 		}
 	}()
 
-	for message := range c.send {
-		if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
-			log.Printf("Write error: %v", err)
-			return
+	for {
+		select {
+		case message, ok := <-c.send:
+			if !ok {
+				// The hub closed the channel; say why if it dropped us
+				if c.closeCode != 0 {
+					c.closeWith(c.closeCode, c.closeReason)
+				}
+				return
+			}
+			if err := c.conn.SetWriteDeadline(time.Now().Add(cfg.WSWriteWait)); err != nil {
+				log.Printf("Failed to set write deadline: %v", err)
+				return
+			}
+			if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				c.handleWriteError(err)
+				return
+			}
+
+		case <-ticker.C:
+			if err := c.conn.SetWriteDeadline(time.Now().Add(cfg.WSWriteWait)); err != nil {
+				log.Printf("Failed to set write deadline: %v", err)
+				return
+			}
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				c.handleWriteError(err)
+				return
+			}
 		}
 	}
 }
+
+func (c *Client) handleWriteError(err error) {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		metrics.writeTimeouts.Add(1)
+		log.Printf("Write timeout for %s", c.name())
+		return
+	}
+	if !errors.Is(err, websocket.ErrCloseSent) {
+		metrics.writeErrors.Add(1)
+		log.Printf("Write error: %v", err)
+	}
+}
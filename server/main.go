@@ -12,6 +12,7 @@ import (
 	"frogs_cafe/database"
 	"frogs_cafe/handlers"
 	"frogs_cafe/middleware"
+	"frogs_cafe/pubsub"
 
 	"github.com/go-chi/chi/v5"
 	chimiddleware "github.com/go-chi/chi/v5/middleware"
@@ -69,25 +70,89 @@ func main() {
 	r := chi.NewRouter()
 
 	// Middleware
+	r.Use(middleware.RealIP(cfg.IsTrustedProxy))
 	r.Use(chimiddleware.Logger)
 	r.Use(chimiddleware.Recoverer)
 	r.Use(chimiddleware.RequestID)
 
-	// CORS configuration for development
+	// CORS configuration, driven by ALLOWED_ORIGINS. Credentials are never
+	// shared with every origin; auth uses bearer tokens anyway
 	r.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   []string{"http://localhost:3000"},
+		AllowOriginFunc: func(r *http.Request, origin string) bool {
+			return cfg.IsOriginAllowed(origin)
+		},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
-		AllowCredentials: true,
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "Idempotency-Key"},
+		ExposedHeaders:   []string{"Link", "Idempotent-Replayed"},
+		AllowCredentials: !cfg.AllowsAnyOrigin(),
 		MaxAge:           300,
 	}))
 
+	// Initialize the pub/sub backend that fans hub events out to every instance
+	bus, err := pubsub.New(cfg.PubSubBackend, db)
+	if err != nil {
+		log.Fatalf("Failed to start pub/sub: %v", err)
+	}
+	defer func() {
+		if err := bus.Close(); err != nil {
+			log.Printf("Failed to close pub/sub: %v", err)
+		}
+	}()
+	log.Printf("Using %s pub/sub backend", cfg.PubSubBackend)
+
 	// Initialize handlers
-	h := handlers.New(db)
+	h := handlers.New(db, cfg, bus)
+
+	// Start stale game cleanup goroutine (cancels games nobody joined)
+	go func() {
+		ticker := time.NewTicker(10 * time.Minute)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			count, err := h.CancelStaleGames(cfg.WaitingGameMaxAge)
+			if err != nil {
+				log.Printf("Failed to cancel stale games: %v", err)
+			} else if count > 0 {
+				log.Printf("Cancelled %d stale waiting games", count)
+			}
+		}
+	}()
+
+	// Start idempotency key cleanup goroutine (runs every hour)
+	go func() {
+		ticker := time.NewTicker(1 * time.Hour)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			count, err := h.CleanupIdempotencyKeys(cfg.IdempotencyKeyTTL)
+			if err != nil {
+				log.Printf("Failed to cleanup idempotency keys: %v", err)
+			} else if count > 0 {
+				log.Printf("Cleaned up %d expired idempotency keys", count)
+			}
+		}
+	}()
+
+	// Start opening explorer indexing goroutine (catches up at startup, then
+	// every 5 minutes; IndexFinishedGames says why it polls)
+	go func() {
+		ticker := time.NewTicker(5 * time.Minute)
+		defer ticker.Stop()
+
+		for {
+			count, err := h.IndexFinishedGames()
+			if err != nil {
+				log.Printf("Failed to index finished games: %v", err)
+			} else if count > 0 {
+				log.Printf("Indexed %d finished games for the opening explorer", count)
+			}
+			<-ticker.C
+		}
+	}()
 
 	// Routes
 	r.Get("/health", h.HealthCheck)
+	r.Get("/metrics", h.Metrics)
 
 	// API routes
 	r.Route("/api/v1", func(r chi.Router) {
@@ -100,18 +165,49 @@ func main() {
 		r.Get("/games", h.ListGames)
 		r.Get("/games/{gameID}", h.GetGame)
 		r.Get("/games/{gameID}/moves", h.GetGameMoves)
+		r.Get("/games/{gameID}/position", h.GetGamePosition)
+		r.Get("/games/{gameID}/sgf", h.GetGameSGF)
+		r.Get("/games/{gameID}/board.svg", h.BoardSVG)
+		r.Get("/games/{gameID}/board.png", h.BoardPNG)
+		r.Get("/games/{gameID}/replay.gif", h.ReplayGIF)
+		r.Get("/games/{gameID}/events", h.GameEvents)
+		r.Get("/games/{gameID}/events/poll", h.PollGameEvents)
+		r.Get("/games/{gameID}/reviews", h.ListGameReviews)
+		r.Get("/reviews/{reviewID}", h.GetReview)
+		r.Get("/reviews/{reviewID}/sgf", h.GetReviewSGF)
+		r.Get("/demos", h.ListDemos)
+		r.Get("/demos/{demoID}", h.GetDemo)
+		r.Get("/demos/{demoID}/sgf", h.GetDemoSGF)
+		r.Get("/explorer", h.Explorer)
 
 		// Protected game routes (require authentication)
 		r.Group(func(r chi.Router) {
 			r.Use(middleware.RequireAuth(db.DB))
-			r.Post("/games", h.CreateGame)
-			r.Post("/games/{gameID}/join", h.JoinGame)
+			r.Post("/games", h.Idempotent("create_game", h.CreateGame))
+			r.Post("/games/import", h.Idempotent("import", h.ImportGame))
+			r.Post("/games/{gameID}/join", h.Idempotent("join", h.JoinGame))
+			r.Delete("/games/{gameID}", h.Idempotent("cancel", h.CancelGame))
+			r.Post("/games/{gameID}/moves", h.Idempotent("move", h.MakeMove))
+			r.Post("/games/{gameID}/annotations", h.Idempotent("annotate", h.CreateAnnotation))
+			r.Put("/games/{gameID}/annotations/{annotationID}", h.UpdateAnnotation)
+			r.Delete("/games/{gameID}/annotations/{annotationID}", h.DeleteAnnotation)
+			r.Post("/games/{gameID}/reviews", h.Idempotent("create_review", h.CreateReview))
+			r.Post("/reviews/{reviewID}/nodes", h.AddReviewNode)
+			r.Put("/reviews/{reviewID}/nodes/{nodeID}", h.UpdateReviewNode)
+			r.Delete("/reviews/{reviewID}/nodes/{nodeID}", h.DeleteReviewNode)
+			r.Put("/reviews/{reviewID}/current", h.SetReviewCurrent)
+			r.Post("/demos", h.Idempotent("create_demo", h.CreateDemo))
+			r.Post("/demos/{demoID}/actions", h.AddDemoAction)
+			r.Post("/demos/{demoID}/undo", h.UndoDemoAction)
+			r.Put("/demos/{demoID}/presenters/{playerID}", h.SetDemoPresenter)
+			r.Delete("/demos/{demoID}/presenters/{playerID}", h.RemoveDemoPresenter)
 		})
 
 		// Player routes
 		r.Get("/players", h.ListPlayers)
 		r.Post("/players", h.CreatePlayer)
 		r.Get("/players/{playerID}", h.GetPlayer)
+		r.Get("/players/{playerID}/games/export", h.ExportPlayerGames)
 	})
 
 	// WebSocket route
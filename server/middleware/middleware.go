@@ -3,7 +3,9 @@ package middleware
 import (
 	"context"
 	"database/sql"
+	"net"
 	"net/http"
+	"net/netip"
 	"strings"
 
 	"frogs_cafe/auth"
@@ -49,3 +51,59 @@ func GetPlayerID(r *http.Request) (int, bool) {
 	playerID, ok := r.Context().Value(PlayerIDKey).(int)
 	return playerID, ok
 }
+
+// RealIP replaces r.RemoteAddr with the client address reported by a
+// trusted reverse proxy. Requests that do not come straight from a trusted
+// proxy keep their own address, whatever headers they carry.
+func RealIP(isTrusted func(netip.Addr) bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if peer, ok := parseAddr(r.RemoteAddr); ok && isTrusted(peer) {
+				if client, ok := forwardedFor(r, isTrusted); ok {
+					r.RemoteAddr = client.String()
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// forwardedFor finds the client behind a chain of trusted proxies. Each
+// proxy appends the address it received the request from to
+// X-Forwarded-For, so the client is the last entry that is not itself a
+// trusted proxy; entries before it could have been sent by the client.
+func forwardedFor(r *http.Request, isTrusted func(netip.Addr) bool) (netip.Addr, bool) {
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	if len(hops) == 0 {
+		return parseAddr(r.Header.Get("X-Real-IP"))
+	}
+
+	var client netip.Addr
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, ok := parseAddr(hops[i])
+		if !ok {
+			break
+		}
+		client = addr
+		if !isTrusted(addr) {
+			break
+		}
+	}
+	return client, client.IsValid()
+}
+
+// parseAddr parses an IP address, with or without a port.
+func parseAddr(value string) (netip.Addr, bool) {
+	value = strings.TrimSpace(value)
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		value = host
+	}
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
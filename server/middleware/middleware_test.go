@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestRealIP(t *testing.T) {
+	proxies := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("2001:db8:ffff::/48"),
+	}
+	isTrusted := func(addr netip.Addr) bool {
+		for _, p := range proxies {
+			if p.Contains(addr) {
+				return true
+			}
+		}
+		return false
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string // X-Forwarded-For headers
+		realIP     string
+		want       string
+	}{
+		{
+			name:       "direct client keeps its address",
+			remoteAddr: "198.51.100.7:4000",
+			want:       "198.51.100.7:4000",
+		},
+		{
+			name:       "spoofed X-Forwarded-For from an untrusted peer is ignored",
+			remoteAddr: "198.51.100.7:4000",
+			forwarded:  []string{"203.0.113.9"},
+			want:       "198.51.100.7:4000",
+		},
+		{
+			name:       "spoofed X-Real-IP from an untrusted peer is ignored",
+			remoteAddr: "198.51.100.7:4000",
+			realIP:     "203.0.113.9",
+			want:       "198.51.100.7:4000",
+		},
+		{
+			name:       "one trusted proxy",
+			remoteAddr: "10.0.0.1:4000",
+			forwarded:  []string{"198.51.100.7"},
+			want:       "198.51.100.7",
+		},
+		{
+			name:       "client-supplied entries before the proxy's are skipped",
+			remoteAddr: "10.0.0.1:4000",
+			forwarded:  []string{"203.0.113.9, 192.0.2.1, 198.51.100.7"},
+			want:       "198.51.100.7",
+		},
+		{
+			name:       "chain of trusted proxies",
+			remoteAddr: "10.0.0.1:4000",
+			forwarded:  []string{"203.0.113.9, 198.51.100.7, 10.1.2.3, 10.4.5.6"},
+			want:       "198.51.100.7",
+		},
+		{
+			name:       "chain split over several headers",
+			remoteAddr: "10.0.0.1:4000",
+			forwarded:  []string{"203.0.113.9, 198.51.100.7", "10.1.2.3"},
+			want:       "198.51.100.7",
+		},
+		{
+			name:       "only trusted hops uses the furthest",
+			remoteAddr: "10.0.0.1:4000",
+			forwarded:  []string{"10.9.9.9, 10.1.2.3"},
+			want:       "10.9.9.9",
+		},
+		{
+			name:       "garbage stops the walk at the proxy",
+			remoteAddr: "10.0.0.1:4000",
+			forwarded:  []string{"198.51.100.7, not-an-ip"},
+			want:       "10.0.0.1:4000",
+		},
+		{
+			name:       "X-Real-IP from a trusted proxy",
+			remoteAddr: "10.0.0.1:4000",
+			realIP:     "198.51.100.7",
+			want:       "198.51.100.7",
+		},
+		{
+			name:       "X-Forwarded-For wins over X-Real-IP",
+			remoteAddr: "10.0.0.1:4000",
+			forwarded:  []string{"198.51.100.7"},
+			realIP:     "203.0.113.9",
+			want:       "198.51.100.7",
+		},
+		{
+			name:       "IPv4-mapped proxy address",
+			remoteAddr: "[::ffff:10.0.0.1]:4000",
+			forwarded:  []string{"198.51.100.7"},
+			want:       "198.51.100.7",
+		},
+		{
+			name:       "IPv6 proxy and client",
+			remoteAddr: "[2001:db8:ffff::1]:4000",
+			forwarded:  []string{"2001:db8:1::7"},
+			want:       "2001:db8:1::7",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			handler := RealIP(isTrusted)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.RemoteAddr
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+
+			if got != tt.want {
+				t.Errorf("RemoteAddr = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,6 +2,8 @@ package models
 
 import (
 	"time"
+
+	"frogs_cafe/rules"
 )
 
 type Player struct {
@@ -19,7 +21,7 @@ type Game struct {
 	BlackPlayerID *int      `json:"black_player_id"`
 	WhitePlayerID *int      `json:"white_player_id"`
 	BoardSize     int       `json:"board_size"`
-	Status        string    `json:"status"` // waiting, active, finished
+	Status        string    `json:"status"` // waiting, active, finished, cancelled, imported
 	WinnerID      *int      `json:"winner_id"`
 	CreatorID     *int      `json:"creator_id"` // Who created the game (for join validation)
 	CreatedAt     time.Time `json:"created_at"`
@@ -29,13 +31,195 @@ type Game struct {
 type Move struct {
 	ID         int       `json:"id"`
 	GameID     int       `json:"game_id"`
-	PlayerID   int       `json:"player_id"`
+	PlayerID   int       `json:"player_id"` // 0 in imported games
+	MoveNumber int       `json:"move_number"`
+	X          int       `json:"x"` // -1 for a pass
+	Y          int       `json:"y"`
+	Color      string    `json:"color,omitempty"` // black or white; empty in older games
+	Pass       bool      `json:"pass,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+
+	Annotations []Annotation `json:"annotations,omitempty"` // Only when requested
+}
+
+// Annotation is a comment and board markup that a player attached to a
+// move of a game.
+type Annotation struct {
+	ID         int       `json:"id"`
+	GameID     int       `json:"game_id"`
+	MoveNumber int       `json:"move_number"`
+	AuthorID   int       `json:"author_id"`
+	AuthorName string    `json:"author_name"`
+	Comment    string    `json:"comment"`
+	Markup     []Markup  `json:"markup"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// Markup types
+const (
+	MarkupTriangle = "triangle"
+	MarkupSquare   = "square"
+	MarkupCircle   = "circle"
+	MarkupLabel    = "label"
+)
+
+// Markup marks an intersection with a shape, or with Label for MarkupLabel.
+type Markup struct {
+	Type  string `json:"type"`
+	X     int    `json:"x"`
+	Y     int    `json:"y"`
+	Label string `json:"label,omitempty"`
+}
+
+// GamePosition is a game as it stood after MoveNumber of its TotalMoves
+// moves, worked out on the server so clients need not know the rules.
+type GamePosition struct {
+	GameID     int          `json:"game_id"`
+	MoveNumber int          `json:"move_number"`
+	TotalMoves int          `json:"total_moves"`
+	Board      [][]string   `json:"board"` // [y][x]: "black", "white" or ""
+	Captures   Captures     `json:"captures"`
+	Ko         *rules.Point `json:"ko"`
+	ToMove     string       `json:"to_move"`   // "black" or "white"
+	LastMove   *rules.Point `json:"last_move"` // Unset at the start and after a pass
+}
+
+// GameRecord is the game information of an imported SGF file that has no
+// place in Game. Players in imported games need not have accounts, so they
+// are known by name.
+type GameRecord struct {
+	GameID      int           `json:"game_id"`
+	Name        string        `json:"name,omitempty"`
+	Event       string        `json:"event,omitempty"`
+	Place       string        `json:"place,omitempty"`
+	Date        string        `json:"date,omitempty"` // As written in the file
+	BlackName   string        `json:"black_name,omitempty"`
+	WhiteName   string        `json:"white_name,omitempty"`
+	BlackRank   string        `json:"black_rank,omitempty"`
+	WhiteRank   string        `json:"white_rank,omitempty"`
+	Komi        *float64      `json:"komi,omitempty"`
+	Handicap    int           `json:"handicap,omitempty"`
+	Rules       string        `json:"rules,omitempty"`
+	MainTime    *float64      `json:"main_time,omitempty"` // Seconds
+	Overtime    string        `json:"overtime,omitempty"`
+	Result      string        `json:"result,omitempty"`
+	SetupBlack  []rules.Point `json:"setup_black"`
+	SetupWhite  []rules.Point `json:"setup_white"`
+	FirstPlayer string        `json:"first_player,omitempty"` // black or white, if the file says
+	Source      string        `json:"-"`                      // The uploaded file, variations and all
+}
+
+// ImportGameResponse describes a game created from an SGF file. Only the
+// main line is imported; DroppedVariations counts the side branches left
+// out, which are still kept in the stored file.
+type ImportGameResponse struct {
+	Game              Game       `json:"game"`
+	Record            GameRecord `json:"record"`
+	Moves             int        `json:"moves"`
+	DroppedVariations int        `json:"dropped_variations"`
+	Warnings          []string   `json:"warnings"`
+}
+
+// SGFErrorData reports why an SGF file could not be imported. Line and
+// Column locate syntax errors.
+type SGFErrorData struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+}
+
+// Review is a study of a finished or imported game: a tree of variations
+// that starts from the game's initial position. Only its owner may change
+// it; CurrentNodeID is the node the owner is showing to viewers. Nodes is
+// only filled in when a single review is requested.
+type Review struct {
+	ID            int          `json:"id"`
+	GameID        int          `json:"game_id"`
+	OwnerID       int          `json:"owner_id"`
+	Title         string       `json:"title"`
+	CurrentNodeID *int         `json:"current_node_id"`
+	CreatedAt     time.Time    `json:"created_at"`
+	UpdatedAt     time.Time    `json:"updated_at"`
+	Nodes         []ReviewNode `json:"nodes,omitempty"`
+}
+
+// ReviewNode is a move in a review's tree. The root has no parent and no
+// move; MoveNumber counts the moves from the root. Siblings are listed in
+// the order they were added, so the first child of a node is its main line.
+type ReviewNode struct {
+	ID         int       `json:"id"`
+	ReviewID   int       `json:"review_id"`
+	ParentID   *int      `json:"parent_id"`
 	MoveNumber int       `json:"move_number"`
-	X          int       `json:"x"`
+	Color      string    `json:"color,omitempty"` // black or white; empty for the root
+	X          int       `json:"x"`               // -1 for a pass and the root
 	Y          int       `json:"y"`
+	Pass       bool      `json:"pass,omitempty"`
+	Comment    string    `json:"comment,omitempty"`
 	CreatedAt  time.Time `json:"created_at"`
 }
 
+// DemoBoard is a board that presenters use to show positions and
+// sequences to viewers, outside of any game. The owner and Presenters may
+// change it.
+type DemoBoard struct {
+	ID         int       `json:"id"`
+	OwnerID    int       `json:"owner_id"`
+	Title      string    `json:"title"`
+	BoardSize  int       `json:"board_size"`
+	Presenters []int     `json:"presenters"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// Demo board action types
+const (
+	DemoPlay   = "play"   // Play Color at X,Y, capturing as in a game
+	DemoPlace  = "place"  // Put a stone of Color at X,Y without captures
+	DemoRemove = "remove" // Take the stone at X,Y off
+	DemoClear  = "clear"  // Empty the board
+	DemoSetup  = "setup"  // Replace the position with Black and White, Color to play
+)
+
+// DemoAction is one change to a demo board. Seq numbers the actions of a
+// board from 1.
+type DemoAction struct {
+	Seq       int           `json:"seq"`
+	Type      string        `json:"type"`
+	Color     string        `json:"color,omitempty"`
+	X         int           `json:"x"`
+	Y         int           `json:"y"`
+	Black     []rules.Point `json:"black,omitempty"`
+	White     []rules.Point `json:"white,omitempty"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+// ExplorerData lists the moves played after an opening sequence in this
+// server's finished games. Moves equivalent by a symmetry of the position
+// are counted together and shown once, in the orientation of Moves.
+type ExplorerData struct {
+	BoardSize     int            `json:"board_size"`
+	Moves         []rules.Point  `json:"moves"`
+	Games         int            `json:"games"` // Games that went on past Moves
+	Continuations []ExplorerMove `json:"continuations"`
+}
+
+// ExplorerMove is one continuation in ExplorerData. AverageRating is the
+// mean current rating of the players in those games.
+type ExplorerMove struct {
+	X             int     `json:"x"`
+	Y             int     `json:"y"`
+	Move          string  `json:"move"` // SGF point
+	Games         int     `json:"games"`
+	BlackWins     int     `json:"black_wins"`
+	WhiteWins     int     `json:"white_wins"`
+	BlackWinRate  float64 `json:"black_win_rate"`
+	WhiteWinRate  float64 `json:"white_win_rate"`
+	AverageRating float64 `json:"average_rating"`
+}
+
 type CreatePlayerRequest struct {
 	Username string `json:"username"`
 	Email    string `json:"email"`
@@ -47,11 +231,64 @@ type CreateGameRequest struct {
 	BoardSize     int  `json:"board_size"`
 }
 
+// MakeMoveRequest is the body of POST /games/{gameID}/moves. GameID and
+// PlayerID are optional; the URL and session are authoritative. MoveNumber,
+// if set, is the number the client expects the move to get.
 type MakeMoveRequest struct {
-	GameID   int `json:"game_id"`
-	PlayerID int `json:"player_id"`
-	X        int `json:"x"`
-	Y        int `json:"y"`
+	GameID     int `json:"game_id"`
+	PlayerID   int `json:"player_id"`
+	X          int `json:"x"`
+	Y          int `json:"y"`
+	MoveNumber int `json:"move_number"`
+}
+
+type CreateDemoRequest struct {
+	Title     string `json:"title"`
+	BoardSize int    `json:"board_size"`
+}
+
+// DemoActionRequest is the body of POST /demos/{demoID}/actions. Which
+// fields matter depends on Type; Color is optional for DemoPlay, where it
+// defaults to the player to move.
+type DemoActionRequest struct {
+	Type  string        `json:"type"`
+	Color string        `json:"color"`
+	X     int           `json:"x"`
+	Y     int           `json:"y"`
+	Black []rules.Point `json:"black"`
+	White []rules.Point `json:"white"`
+}
+
+// AnnotationRequest is the body of POST and PUT
+// /games/{gameID}/annotations. MoveNumber is ignored when updating.
+type AnnotationRequest struct {
+	MoveNumber int      `json:"move_number"`
+	Comment    string   `json:"comment"`
+	Markup     []Markup `json:"markup"`
+}
+
+type CreateReviewRequest struct {
+	Title string `json:"title"`
+}
+
+// AddReviewNodeRequest is the body of POST /reviews/{reviewID}/nodes.
+// Color defaults to the player to move after ParentID; set it to play two
+// moves of the same color in a row.
+type AddReviewNodeRequest struct {
+	ParentID int    `json:"parent_id"`
+	X        int    `json:"x"`
+	Y        int    `json:"y"`
+	Pass     bool   `json:"pass"`
+	Color    string `json:"color"`
+	Comment  string `json:"comment"`
+}
+
+type UpdateReviewNodeRequest struct {
+	Comment string `json:"comment"`
+}
+
+type SetReviewCurrentRequest struct {
+	NodeID int `json:"node_id"`
 }
 
 type RegisterRequest struct {
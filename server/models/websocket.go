@@ -1,17 +1,244 @@
 package models
 
-// WebSocketMessage represents the structure of messages sent over WebSocket
+import (
+	"encoding/json"
+
+	"frogs_cafe/rules"
+)
+
+// ProtocolVersion is the WebSocket protocol version spoken by this server.
+// Clients request a version with the ?protocol= query parameter when they
+// connect; the server confirms it in the hello message.
+const ProtocolVersion = 1
+
+// SupportedProtocolVersions lists every protocol version the server accepts.
+var SupportedProtocolVersions = []int{1}
+
+// CloseUnsupportedProtocol is the WebSocket close code sent when a client
+// asks for a protocol version the server does not speak.
+const CloseUnsupportedProtocol = 4000
+
+// Client to server message types
+const (
+	MsgAuthenticate = "authenticate"
+	MsgSubscribe    = "subscribe"
+	MsgUnsubscribe  = "unsubscribe"
+	MsgResume       = "resume"
+	MsgMove         = "move"
+	MsgChat         = "chat"
+)
+
+// Server to client message types
+const (
+	MsgHello          = "hello"
+	MsgAuthSuccess    = "auth_success"
+	MsgAuthError      = "auth_error"
+	MsgSubscribed     = "subscribed"
+	MsgUnsubscribed   = "unsubscribed"
+	MsgSubscribeError = "subscribe_error"
+	MsgResumed        = "resumed"
+	MsgGameState      = "game_state"
+	MsgGameUpdate     = "game_update"
+	MsgError          = "error"
+)
+
+// Review event types, delivered to clients subscribed to a review. A
+// review_state with the whole review comes first.
+const (
+	MsgReviewState       = "review_state"        // Review, with its nodes
+	MsgReviewCurrent     = "review_current"      // ReviewCurrentData
+	MsgReviewNodeAdded   = "review_node_added"   // ReviewNode
+	MsgReviewNodeUpdated = "review_node_updated" // ReviewNode
+	MsgReviewNodeRemoved = "review_node_removed" // ReviewNodeRemovedData
+)
+
+// MsgDemoState is sent to clients subscribed to a demo board when they
+// subscribe and whenever it changes, with a DemoStateData payload
+const MsgDemoState = "demo_state"
+
+// Lobby event types, delivered only to clients subscribed to the lobby.
+// Each carries a GameUpdateData payload.
+const (
+	LobbyGameCreated   = "game_created"
+	LobbyGameStarted   = "game_started"
+	LobbyGameCancelled = "game_cancelled"
+)
+
+// Error codes carried in ErrorData
+const (
+	ErrCodeInvalidMessage = "invalid_message"
+	ErrCodeUnknownType    = "unknown_type"
+	ErrCodeUnauthorized   = "unauthorized"
+	ErrCodeMoveRejected   = "move_rejected"
+	ErrCodeRateLimited    = "rate_limited"
+
+	// Reasons a move is refused, shared by the WebSocket and REST APIs
+	ErrCodeGameNotFound  = "game_not_found"
+	ErrCodeGameNotActive = "game_not_active"
+	ErrCodeNotAPlayer    = "not_a_player"
+	ErrCodeNotYourTurn   = "not_your_turn"
+	ErrCodeIllegalMove   = "illegal_move"
+	ErrCodeStaleMove     = "stale_move"
+
+	// Idempotency key conflicts
+	ErrCodeIdempotencyKeyReused = "idempotency_key_reused"
+	ErrCodeRequestInProgress    = "request_in_progress"
+
+	// SGF import failures
+	ErrCodeInvalidSGF = "invalid_sgf"
+)
+
+// WebSocketMessage represents the structure of messages sent over WebSocket.
+// Game events carry a per-game sequence number that increases by one with
+// every event broadcast for that game.
 type WebSocketMessage struct {
 	Type string      `json:"type"`
+	Seq  int64       `json:"seq,omitempty"`
 	Data interface{} `json:"data"`
 }
 
-// MoveData represents the data payload for a move message
+// IncomingMessage is a message received from a client. Data is decoded into
+// the payload type registered for Type once the type is known.
+type IncomingMessage struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// HelloData is sent once a connection is established. Epoch identifies the
+// server run that assigned sequence numbers; it must be echoed in resume.
+type HelloData struct {
+	ProtocolVersion int    `json:"protocol_version"`
+	Epoch           string `json:"epoch"`
+	PlayerID        int    `json:"player_id"`
+	Username        string `json:"username"`
+}
+
+// AuthenticateData upgrades a guest connection to an authenticated one
+type AuthenticateData struct {
+	Token string `json:"token"`
+}
+
+// AuthSuccessData confirms an authentication upgrade
+type AuthSuccessData struct {
+	PlayerID int    `json:"player_id"`
+	Username string `json:"username"`
+}
+
+// SubscribeData names the channel to subscribe to or unsubscribe from:
+// a game_id, a review_id, a demo_id or the "lobby" channel.
+type SubscribeData struct {
+	GameID   *int   `json:"game_id,omitempty"`
+	ReviewID *int   `json:"review_id,omitempty"`
+	DemoID   *int   `json:"demo_id,omitempty"`
+	Channel  string `json:"channel,omitempty"`
+}
+
+// SubscriptionData acknowledges a subscription change
+type SubscriptionData struct {
+	Channel string `json:"channel"`
+	Error   string `json:"error,omitempty"`
+}
+
+// ResumeData subscribes to a game after a reconnect, asking for every event
+// after LastSeq. Events are replayed when still buffered; otherwise the
+// server sends a fresh game_state.
+type ResumeData struct {
+	GameID  int    `json:"game_id"`
+	LastSeq int64  `json:"last_seq"`
+	Epoch   string `json:"epoch"`
+}
+
+// ResumedData confirms that missed events were replayed
+type ResumedData struct {
+	GameID   int   `json:"game_id"`
+	Seq      int64 `json:"seq"`
+	Replayed int   `json:"replayed"`
+}
+
+// GameStateData is a full snapshot of a game, sent when a client starts
+// following it. Every event up to and including Seq is reflected in it;
+// events queued after it may repeat moves already listed, which clients
+// recognise by move_number.
+type GameStateData struct {
+	GameID     int          `json:"game_id"`
+	Seq        int64        `json:"seq"`
+	Game       Game         `json:"game"`
+	Moves      []Move       `json:"moves"`
+	Board      [][]string   `json:"board"` // [y][x]: "black", "white" or ""
+	Captures   Captures     `json:"captures"`
+	Ko         *rules.Point `json:"ko"`
+	ToMove     string       `json:"to_move"` // "black" or "white"
+	Spectators int          `json:"spectators"`
+
+	Record *GameRecord `json:"record,omitempty"` // Imported games only
+}
+
+// Captures counts the stones captured by each player
+type Captures struct {
+	Black int `json:"black"`
+	White int `json:"white"`
+}
+
+// EventPollData is returned by the long-poll event stream: the messages a
+// WebSocket client would have received since the poll began. Epoch is
+// echoed in the next poll along with the seq of the last event seen.
+type EventPollData struct {
+	Epoch    string            `json:"epoch"`
+	Messages []json.RawMessage `json:"messages"`
+}
+
+// MoveData represents the data payload for a move message. Clients may set
+// MoveNumber to the number they expect their move to get; the server
+// rejects the move as stale if another move got there first. A client
+// generated IdempotencyKey makes retries safe: a move resent with the same
+// key is answered with the original outcome instead of being played again.
+// The key is never broadcast.
 type MoveData struct {
-	X        int `json:"x"`
-	Y        int `json:"y"`
-	GameID   int `json:"game_id"`
-	PlayerID int `json:"player_id"`
+	X              int    `json:"x"`
+	Y              int    `json:"y"`
+	GameID         int    `json:"game_id"`
+	PlayerID       int    `json:"player_id"`
+	MoveNumber     int    `json:"move_number"`
+	Color          string `json:"color,omitempty"` // black or white; set on moves the server sends
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+}
+
+// ChatData represents a chat message within a game
+type ChatData struct {
+	GameID   int    `json:"game_id"`
+	PlayerID int    `json:"player_id"`
+	Username string `json:"username"`
+	Text     string `json:"text"`
+}
+
+// ErrorData reports a rejected client message
+type ErrorData struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Type    string `json:"type,omitempty"` // Type of the message that was rejected
+}
+
+// ReviewCurrentData announces the node a review's owner moved to
+type ReviewCurrentData struct {
+	ReviewID int `json:"review_id"`
+	NodeID   int `json:"node_id"`
+}
+
+// ReviewNodeRemovedData announces that a node was deleted along with every
+// node below it
+type ReviewNodeRemovedData struct {
+	ReviewID int `json:"review_id"`
+	NodeID   int `json:"node_id"`
+}
+
+// DemoStateData is the position on a demo board after its Seq'th action.
+type DemoStateData struct {
+	Demo     DemoBoard    `json:"demo"`
+	Seq      int          `json:"seq"`
+	Board    [][]string   `json:"board"` // [y][x]: "black", "white" or ""
+	Captures Captures     `json:"captures"`
+	ToMove   string       `json:"to_move"`
+	LastMove *rules.Point `json:"last_move"` // Set right after a play
 }
 
 // GameUpdateData represents the data payload for a game status update
@@ -0,0 +1,41 @@
+package pubsub
+
+import "sync"
+
+// Memory is the PubSub for running a single instance. There are no other
+// instances to reach, and the hub delivers its own events directly, so
+// published payloads go nowhere.
+type Memory struct {
+	messages chan Message
+	mutex    sync.RWMutex
+	closed   bool
+}
+
+func NewMemory() *Memory {
+	return &Memory{messages: make(chan Message)}
+}
+
+func (m *Memory) Publish(channel string, payload []byte) error {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	if m.closed {
+		return ErrClosed
+	}
+	return nil
+}
+
+func (m *Memory) Messages() <-chan Message {
+	return m.messages
+}
+
+func (m *Memory) Close() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if !m.closed {
+		m.closed = true
+		close(m.messages)
+	}
+	return nil
+}
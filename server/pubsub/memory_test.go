@@ -0,0 +1,27 @@
+package pubsub
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMemoryPublishNeverBlocks(t *testing.T) {
+	m := NewMemory()
+
+	// Far more than any buffer would hold, with nobody reading
+	for i := range 10_000 {
+		if err := m.Publish("game:1", []byte(`{}`)); err != nil {
+			t.Fatalf("publish %d: %v", i, err)
+		}
+	}
+
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := <-m.Messages(); ok {
+		t.Error("a single instance received its own event")
+	}
+	if err := m.Publish("game:1", []byte(`{}`)); !errors.Is(err, ErrClosed) {
+		t.Errorf("publish after close error = %v, want %v", err, ErrClosed)
+	}
+}
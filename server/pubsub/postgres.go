@@ -0,0 +1,157 @@
+package pubsub
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"frogs_cafe/database"
+
+	"github.com/lib/pq"
+)
+
+// notifyChannel is the Postgres NOTIFY channel shared by all instances.
+const notifyChannel = "frogs_cafe_hub"
+
+// maxNotifyPayload is the largest payload Postgres accepts in a NOTIFY.
+// Larger payloads are stored in pubsub_payloads and sent by reference.
+const maxNotifyPayload = 7999
+
+// referencePrefix starts a notification that names a pubsub_payloads row
+// instead of carrying the payload, as ref:<id>:<channel>. Payloads are JSON,
+// so they never start with it.
+const referencePrefix = "ref:"
+
+// payloadRetention is how long stored payloads are kept for listeners to
+// read.
+const payloadRetention = 5 * time.Minute
+
+// Postgres is a PubSub built on LISTEN/NOTIFY. Events are published with
+// pg_notify over the shared connection pool and received on a dedicated
+// listener connection. Postgres delivers notifications to every listener in
+// commit order, so all instances see events in the same order.
+type Postgres struct {
+	db       *database.DB
+	listener *pq.Listener
+	messages chan Message
+	done     chan struct{}
+}
+
+func NewPostgres(db *database.DB) (*Postgres, error) {
+	listener := pq.NewListener(db.ConnectionString(), 10*time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		switch event {
+		case pq.ListenerEventDisconnected:
+			log.Printf("Pub/sub listener disconnected: %v", err)
+		case pq.ListenerEventReconnected:
+			log.Println("Pub/sub listener reconnected; events sent while disconnected were missed")
+		case pq.ListenerEventConnectionAttemptFailed:
+			log.Printf("Pub/sub listener failed to reconnect: %v", err)
+		}
+	})
+	if err := listener.Listen(notifyChannel); err != nil {
+		if closeErr := listener.Close(); closeErr != nil {
+			log.Printf("Failed to close pub/sub listener: %v", closeErr)
+		}
+		return nil, fmt.Errorf("could not listen on %s: %w", notifyChannel, err)
+	}
+
+	p := &Postgres{
+		db:       db,
+		listener: listener,
+		messages: make(chan Message, 256),
+		done:     make(chan struct{}),
+	}
+	go p.receive()
+	return p, nil
+}
+
+func (p *Postgres) Publish(channel string, payload []byte) error {
+	if len(payload) <= maxNotifyPayload {
+		_, err := p.db.Exec("SELECT pg_notify($1, $2)", notifyChannel, string(payload))
+		return err
+	}
+
+	// Storing and notifying in one statement means the row is committed by
+	// the time anyone is notified. The channel travels with the reference so
+	// listeners that cannot read the row know whom to resynchronise.
+	_, err := p.db.Exec(
+		`WITH stored AS (INSERT INTO pubsub_payloads (payload) VALUES ($2) RETURNING id)
+		SELECT pg_notify($1, '`+referencePrefix+`' || stored.id || ':' || $3) FROM stored`,
+		notifyChannel, string(payload), channel,
+	)
+	return err
+}
+
+func (p *Postgres) Messages() <-chan Message {
+	return p.messages
+}
+
+func (p *Postgres) Close() error {
+	close(p.done)
+	return p.listener.Close()
+}
+
+func (p *Postgres) receive() {
+	defer close(p.messages)
+
+	// Ping now and then so a silently dropped connection is noticed
+	ticker := time.NewTicker(90 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+
+		case n, ok := <-p.listener.Notify:
+			if !ok {
+				return
+			}
+			// A nil notification means the connection was re-established
+			if n == nil {
+				continue
+			}
+			p.messages <- p.message(n.Extra)
+
+		case <-ticker.C:
+			if err := p.listener.Ping(); err != nil {
+				log.Printf("Pub/sub listener ping failed: %v", err)
+			}
+			if _, err := p.db.Exec("DELETE FROM pubsub_payloads WHERE created_at < $1", time.Now().Add(-payloadRetention)); err != nil {
+				log.Printf("Failed to clean up pub/sub payloads: %v", err)
+			}
+		}
+	}
+}
+
+// message returns the payload a notification carries, reading it from
+// pubsub_payloads if it was sent by reference. A payload that cannot be read
+// is reported as lost on its channel.
+func (p *Postgres) message(extra string) Message {
+	ref, ok := strings.CutPrefix(extra, referencePrefix)
+	if !ok {
+		return Message{Payload: []byte(extra)}
+	}
+	ref, channel, _ := strings.Cut(ref, ":")
+	payload, err := p.storedPayload(ref)
+	if err != nil {
+		log.Printf("Failed to load pub/sub payload %s for %s: %v", ref, channel, err)
+		return Message{Channel: channel}
+	}
+	return Message{Channel: channel, Payload: payload}
+}
+
+// storedPayload reads the pubsub_payloads row with the given ID.
+func (p *Postgres) storedPayload(ref string) ([]byte, error) {
+	id, err := strconv.ParseInt(ref, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	var payload string
+	if err := p.db.QueryRow("SELECT payload FROM pubsub_payloads WHERE id = $1", id).Scan(&payload); err != nil {
+		return nil, err
+	}
+	return []byte(payload), nil
+}
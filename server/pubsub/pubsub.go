@@ -0,0 +1,51 @@
+// Package pubsub fans hub events out to every server instance. The hub
+// delivers each broadcast to its own clients straight away and publishes it
+// through a PubSub; events published by other instances come back from
+// Messages and go to its clients too. Subscribers connected to any instance
+// therefore see events published on any other.
+package pubsub
+
+import (
+	"errors"
+	"fmt"
+
+	"frogs_cafe/database"
+)
+
+var ErrClosed = errors.New("pub/sub is closed")
+
+// Message is a payload received from another instance. Payload is nil when
+// the payload published on Channel could not be read; subscribers to that
+// channel have missed an event and need to be brought up to date.
+type Message struct {
+	Channel string
+	Payload []byte
+}
+
+// PubSub is a broadcast bus shared by all server instances.
+type PubSub interface {
+	// Publish sends payload, an event for the hub channel named channel, to
+	// every other instance. A backend may deliver it back to this one too,
+	// so receivers must recognise their own events.
+	Publish(channel string, payload []byte) error
+
+	// Messages delivers the payloads published by other instances, in the
+	// order they were published.
+	Messages() <-chan Message
+
+	// Close stops delivery and releases resources.
+	Close() error
+}
+
+// New returns the backend named by kind: "memory" for a single instance or
+// "postgres" to share events between instances through db.
+func New(kind string, db *database.DB) (PubSub, error) {
+	switch kind {
+	case "", "memory":
+		return NewMemory(), nil
+	case "postgres":
+		return NewPostgres(db)
+	default:
+		return nil, fmt.Errorf("unknown pub/sub backend %q", kind)
+	}
+}
@@ -0,0 +1,79 @@
+package render
+
+import (
+	"bytes"
+	"image"
+	"image/gif"
+	"io"
+	"iter"
+	"time"
+)
+
+// Animate writes positions as an animated GIF, showing each for delay and
+// the last one three times as long before the animation loops. Positions
+// are drawn as they are produced, so the caller may reuse one board for
+// every frame. After the first frame only the area that changed is stored.
+func Animate(w io.Writer, positions iter.Seq[Position], opts Options, delay time.Duration) error {
+	anim := &gif.GIF{}
+	centiseconds := max(1, int(delay/(10*time.Millisecond)))
+
+	var previous *image.Paletted
+	for pos := range positions {
+		frame := Image(pos, opts)
+		if previous != nil {
+			changed := changedBounds(previous, frame)
+			if changed.Empty() {
+				// Nothing to redraw, e.g. after a pass; show the previous
+				// frame for longer instead
+				anim.Delay[len(anim.Delay)-1] += centiseconds
+				continue
+			}
+			previous = frame
+			frame = crop(frame, changed)
+		} else {
+			previous = frame
+		}
+		anim.Image = append(anim.Image, frame)
+		anim.Delay = append(anim.Delay, centiseconds)
+		anim.Disposal = append(anim.Disposal, gif.DisposalNone)
+	}
+	if len(anim.Image) == 0 {
+		return nil
+	}
+	anim.Delay[len(anim.Delay)-1] += 2 * centiseconds
+	return gif.EncodeAll(w, anim)
+}
+
+// crop copies r out of frame. A SubImage would share frame's pixels and keep
+// the whole frame in memory until the GIF is encoded.
+func crop(frame *image.Paletted, r image.Rectangle) *image.Paletted {
+	cropped := image.NewPaletted(r, frame.Palette)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		copy(cropped.Pix[cropped.PixOffset(r.Min.X, y):cropped.PixOffset(r.Max.X, y)],
+			frame.Pix[frame.PixOffset(r.Min.X, y):frame.PixOffset(r.Max.X, y)])
+	}
+	return cropped
+}
+
+// changedBounds returns the smallest rectangle holding every pixel that
+// differs between two images of the same size.
+func changedBounds(a, b *image.Paletted) image.Rectangle {
+	bounds := a.Bounds()
+	changed := image.Rectangle{}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		rowA := a.Pix[a.PixOffset(bounds.Min.X, y):a.PixOffset(bounds.Max.X, y)]
+		rowB := b.Pix[b.PixOffset(bounds.Min.X, y):b.PixOffset(bounds.Max.X, y)]
+		if bytes.Equal(rowA, rowB) {
+			continue
+		}
+		first, last := 0, len(rowA)-1
+		for rowA[first] == rowB[first] {
+			first++
+		}
+		for rowA[last] == rowB[last] {
+			last--
+		}
+		changed = changed.Union(image.Rect(bounds.Min.X+first, y, bounds.Min.X+last+1, y+1))
+	}
+	return changed
+}
@@ -0,0 +1,159 @@
+package render
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"strconv"
+
+	"frogs_cafe/rules"
+)
+
+// Palette indexes
+const (
+	colorBoard uint8 = iota
+	colorBlack
+	colorWhite
+	colorLine
+	colorMarker
+)
+
+// Palette holds every color Image uses, so frames of an animation can
+// share it.
+var Palette = color.Palette{
+	colorBoard:  color.RGBA{0xdc, 0xb3, 0x5c, 0xff},
+	colorBlack:  color.RGBA{0x11, 0x11, 0x11, 0xff},
+	colorWhite:  color.RGBA{0xf5, 0xf5, 0xf5, 0xff},
+	colorLine:   color.RGBA{0x55, 0x55, 0x55, 0xff},
+	colorMarker: color.RGBA{0xd3, 0x33, 0x33, 0xff},
+}
+
+// PNG writes pos as a PNG image.
+func PNG(w io.Writer, pos Position, opts Options) error {
+	return png.Encode(w, Image(pos, opts))
+}
+
+// Image draws pos on a square paletted image.
+func Image(pos Position, opts Options) *image.Paletted {
+	l := newLayout(pos.Board.Size(), opts)
+	c := &canvas{image.NewPaletted(image.Rect(0, 0, l.width, l.width), Palette)}
+	c.fillRect(0, 0, l.width, l.width, colorBoard)
+
+	// Lines
+	first, last := l.at(0), l.at(l.size-1)
+	for i := 0; i < l.size; i++ {
+		c.fillRect(l.at(i), first, l.at(i)+1, last+1, colorBlack)
+		c.fillRect(first, l.at(i), last+1, l.at(i)+1, colorBlack)
+	}
+	starRadius := float64(l.cell)*0.1 + 1
+	for _, p := range starPoints(l.size) {
+		c.fillCircle(l.at(p.X), l.at(p.Y), starRadius, colorBlack)
+	}
+
+	if opts.Coordinates && hasLabels(l.size) {
+		scale := max(1, l.cell*45/100/glyphHeight)
+		offset := l.cell * 9 / 10
+		for i := 0; i < l.size; i++ {
+			col, row := columnLabel(i), rowLabel(l.size, i)
+			c.text(l.at(i), first-offset, col, scale, colorBlack)
+			c.text(l.at(i), last+offset, col, scale, colorBlack)
+			c.text(first-offset, l.at(i), row, scale, colorBlack)
+			c.text(last+offset, l.at(i), row, scale, colorBlack)
+		}
+	}
+
+	// Stones
+	radius := float64(l.cell) * 0.47
+	for y := 0; y < l.size; y++ {
+		for x := 0; x < l.size; x++ {
+			switch pos.Board.At(x, y) {
+			case rules.Black:
+				c.fillCircle(l.at(x), l.at(y), radius, colorBlack)
+			case rules.White:
+				c.fillCircle(l.at(x), l.at(y), radius, colorLine)
+				c.fillCircle(l.at(x), l.at(y), radius-1, colorWhite)
+			}
+		}
+	}
+
+	// Move numbers, with the last one in the marker color, or else a
+	// ring on the last move
+	if pos.Numbers != nil {
+		for p, n := range numberedStones(pos) {
+			text := strconv.Itoa(n)
+			fill := colorBlack
+			if pos.Board.At(p.X, p.Y) == rules.Black {
+				fill = colorWhite
+			}
+			if pos.LastMove != nil && *pos.LastMove == p {
+				fill = colorMarker
+			}
+			scale := max(1, min(l.cell/2/glyphHeight, l.cell*8/10/textWidth(text)))
+			c.text(l.at(p.X), l.at(p.Y), text, scale, fill)
+		}
+	} else if pos.LastMove != nil {
+		outer := float64(l.cell) * 0.25
+		c.ring(l.at(pos.LastMove.X), l.at(pos.LastMove.Y), outer, outer-max(1, float64(l.cell)/12), colorMarker)
+	}
+
+	return c.img
+}
+
+// canvas draws shapes on a paletted image, clipping at its edges.
+type canvas struct {
+	img *image.Paletted
+}
+
+func (c *canvas) set(x, y int, index uint8) {
+	if image.Pt(x, y).In(c.img.Rect) {
+		c.img.SetColorIndex(x, y, index)
+	}
+}
+
+// fillRect fills the rectangle from (x0, y0) up to but excluding (x1, y1).
+func (c *canvas) fillRect(x0, y0, x1, y1 int, index uint8) {
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			c.set(x, y, index)
+		}
+	}
+}
+
+func (c *canvas) fillCircle(cx, cy int, r float64, index uint8) {
+	c.ring(cx, cy, r, -1, index)
+}
+
+// ring fills the points further than inner and no further than outer
+// from (cx, cy).
+func (c *canvas) ring(cx, cy int, outer, inner float64, index uint8) {
+	reach := int(outer) + 1
+	for dy := -reach; dy <= reach; dy++ {
+		for dx := -reach; dx <= reach; dx++ {
+			d := float64(dx*dx + dy*dy)
+			if d <= outer*outer && (inner < 0 || d > inner*inner) {
+				c.set(cx+dx, cy+dy, index)
+			}
+		}
+	}
+}
+
+// text draws text centered on (cx, cy), each font pixel scale pixels wide.
+func (c *canvas) text(cx, cy int, text string, scale int, index uint8) {
+	x0 := cx - textWidth(text)*scale/2
+	y0 := cy - glyphHeight*scale/2
+	for i := 0; i < len(text); i++ {
+		glyph, ok := glyphs[text[i]]
+		if !ok {
+			continue
+		}
+		left := x0 + i*(glyphWidth+1)*scale
+		for row, bits := range glyph {
+			for col := 0; col < glyphWidth; col++ {
+				if bits[col] == '#' {
+					c.fillRect(left+col*scale, y0+row*scale, left+(col+1)*scale, y0+(row+1)*scale, index)
+				}
+			}
+		}
+	}
+}
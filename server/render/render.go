@@ -0,0 +1,122 @@
+// Package render draws Go positions as SVG documents and paletted images,
+// using only the standard library, for link previews, embeds and emails
+// that cannot run the web client.
+package render
+
+import (
+	"iter"
+	"strconv"
+
+	"frogs_cafe/rules"
+)
+
+// Position is a board to draw.
+type Position struct {
+	Board    *rules.Board
+	LastMove *rules.Point        // Marked if set
+	Numbers  map[rules.Point]int // Move numbers printed on stones, if set
+}
+
+// Options control the drawing.
+type Options struct {
+	Width       int  // Image width and height in pixels
+	Coordinates bool // Label the lines A-T and 1-19 around the board
+}
+
+const (
+	// DefaultWidth is used when Options.Width is not set.
+	DefaultWidth = 400
+
+	// MinWidth and MaxWidth bound the requested width.
+	MinWidth = 100
+	MaxWidth = 2000
+)
+
+// layout places the lines of a board within an image.
+type layout struct {
+	size   int // Lines on each side
+	cell   int // Distance between lines
+	margin int // Distance from the image edge to the first line
+	width  int
+}
+
+func newLayout(size int, opts Options) layout {
+	width := opts.Width
+	if width == 0 {
+		width = DefaultWidth
+	}
+	width = max(MinWidth, min(MaxWidth, width))
+
+	// Stones need half a cell beyond the outer lines; labels need more
+	marginCells := 0.75
+	if opts.Coordinates && hasLabels(size) {
+		marginCells = 1.5
+	}
+	cell := max(2, int(float64(width)/(float64(size-1)+2*marginCells)))
+	margin := (width - (size-1)*cell) / 2
+	return layout{size: size, cell: cell, margin: margin, width: width}
+}
+
+// at returns the pixel position of line i.
+func (l layout) at(i int) int {
+	return l.margin + i*l.cell
+}
+
+// columnLabels are the customary column names, which skip I.
+const columnLabels = "ABCDEFGHJKLMNOPQRSTUVWXYZ"
+
+// hasLabels reports whether a board is small enough to label.
+func hasLabels(size int) bool {
+	return size <= len(columnLabels)
+}
+
+func columnLabel(x int) string {
+	return string(columnLabels[x])
+}
+
+// rowLabel numbers rows from the bottom, as players read them.
+func rowLabel(size, y int) string {
+	return strconv.Itoa(size - y)
+}
+
+// starPoints returns the marked intersections of the usual board sizes.
+func starPoints(size int) []rules.Point {
+	var lines []int
+	switch size {
+	case 19:
+		lines = []int{3, 9, 15}
+	case 13:
+		return []rules.Point{{X: 3, Y: 3}, {X: 9, Y: 3}, {X: 6, Y: 6}, {X: 3, Y: 9}, {X: 9, Y: 9}}
+	case 9:
+		return []rules.Point{{X: 2, Y: 2}, {X: 6, Y: 2}, {X: 4, Y: 4}, {X: 2, Y: 6}, {X: 6, Y: 6}}
+	default:
+		return nil
+	}
+	var points []rules.Point
+	for _, y := range lines {
+		for _, x := range lines {
+			points = append(points, rules.Point{X: x, Y: y})
+		}
+	}
+	return points
+}
+
+// numberedStones yields the stones on the board that have a move number,
+// in reading order so output is stable.
+func numberedStones(pos Position) iter.Seq2[rules.Point, int] {
+	return func(yield func(rules.Point, int) bool) {
+		size := pos.Board.Size()
+		for y := 0; y < size; y++ {
+			for x := 0; x < size; x++ {
+				p := rules.Point{X: x, Y: y}
+				n, ok := pos.Numbers[p]
+				if !ok || pos.Board.At(x, y) == rules.Empty {
+					continue
+				}
+				if !yield(p, n) {
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package render
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+
+	"frogs_cafe/rules"
+)
+
+// SVG colors, matching Palette
+const (
+	svgBoard  = "#dcb35c"
+	svgBlack  = "#111111"
+	svgWhite  = "#f5f5f5"
+	svgLine   = "#555555"
+	svgMarker = "#d33333"
+)
+
+// SVG writes pos as a standalone SVG document.
+func SVG(w io.Writer, pos Position, opts Options) error {
+	l := newLayout(pos.Board.Size(), opts)
+	cell := float64(l.cell)
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n", l.width, l.width, l.width, l.width)
+	fmt.Fprintf(bw, `<rect width="%d" height="%d" fill="%s"/>`+"\n", l.width, l.width, svgBoard)
+
+	// Lines
+	first, last := l.at(0), l.at(l.size-1)
+	fmt.Fprintf(bw, `<g stroke="%s" stroke-width="1">`+"\n", svgBlack)
+	for i := 0; i < l.size; i++ {
+		fmt.Fprintf(bw, `<line x1="%d" y1="%d" x2="%d" y2="%d"/>`+"\n", l.at(i), first, l.at(i), last)
+		fmt.Fprintf(bw, `<line x1="%d" y1="%d" x2="%d" y2="%d"/>`+"\n", first, l.at(i), last, l.at(i))
+	}
+	bw.WriteString("</g>\n")
+	for _, p := range starPoints(l.size) {
+		fmt.Fprintf(bw, `<circle cx="%d" cy="%d" r="%.1f" fill="%s"/>`+"\n", l.at(p.X), l.at(p.Y), cell*0.1+1, svgBlack)
+	}
+
+	if opts.Coordinates && hasLabels(l.size) {
+		fontSize := cell * 0.45
+		fmt.Fprintf(bw, `<g font-family="sans-serif" font-size="%.1f" fill="%s" text-anchor="middle" dominant-baseline="central">`+"\n", fontSize, svgBlack)
+		near, far := float64(l.margin)-cell*0.9, float64(last)+cell*0.9
+		for i := 0; i < l.size; i++ {
+			col, row := columnLabel(i), rowLabel(l.size, i)
+			fmt.Fprintf(bw, `<text x="%d" y="%.1f">%s</text><text x="%d" y="%.1f">%s</text>`+"\n", l.at(i), near, col, l.at(i), far, col)
+			fmt.Fprintf(bw, `<text x="%.1f" y="%d">%s</text><text x="%.1f" y="%d">%s</text>`+"\n", near, l.at(i), row, far, l.at(i), row)
+		}
+		bw.WriteString("</g>\n")
+	}
+
+	// Stones
+	radius := cell * 0.47
+	for y := 0; y < l.size; y++ {
+		for x := 0; x < l.size; x++ {
+			switch pos.Board.At(x, y) {
+			case rules.Black:
+				fmt.Fprintf(bw, `<circle cx="%d" cy="%d" r="%.1f" fill="%s"/>`+"\n", l.at(x), l.at(y), radius, svgBlack)
+			case rules.White:
+				fmt.Fprintf(bw, `<circle cx="%d" cy="%d" r="%.1f" fill="%s" stroke="%s" stroke-width="1"/>`+"\n", l.at(x), l.at(y), radius-0.5, svgWhite, svgLine)
+			}
+		}
+	}
+
+	// Move numbers, with the last one in the marker color, or else a
+	// ring on the last move
+	if pos.Numbers != nil {
+		fmt.Fprintf(bw, `<g font-family="sans-serif" font-weight="bold" text-anchor="middle" dominant-baseline="central">`+"\n")
+		for p, n := range numberedStones(pos) {
+			color := pos.Board.At(p.X, p.Y)
+			text := strconv.Itoa(n)
+			fill := svgBlack
+			if color == rules.Black {
+				fill = svgWhite
+			}
+			if pos.LastMove != nil && *pos.LastMove == p {
+				fill = svgMarker
+			}
+			size := cell * 0.5
+			if len(text) > 2 {
+				size = cell * 0.38
+			}
+			fmt.Fprintf(bw, `<text x="%d" y="%d" font-size="%.1f" fill="%s">%s</text>`+"\n", l.at(p.X), l.at(p.Y), size, fill, text)
+		}
+		bw.WriteString("</g>\n")
+	} else if pos.LastMove != nil {
+		fmt.Fprintf(bw, `<circle cx="%d" cy="%d" r="%.1f" fill="none" stroke="%s" stroke-width="%.1f"/>`+"\n",
+			l.at(pos.LastMove.X), l.at(pos.LastMove.Y), cell*0.25, svgMarker, max(1, cell/12))
+	}
+
+	bw.WriteString("</svg>\n")
+	return bw.Flush()
+}
@@ -0,0 +1,266 @@
+// Package rules implements the rules of Go needed to replay and validate
+// games: placing stones, captures, suicide and simple ko.
+package rules
+
+import "errors"
+
+// Color is the occupant of an intersection, or the player to move.
+type Color int8
+
+const (
+	Empty Color = iota
+	Black
+	White
+)
+
+// Opponent returns the other player's color.
+func (c Color) Opponent() Color {
+	switch c {
+	case Black:
+		return White
+	case White:
+		return Black
+	default:
+		return Empty
+	}
+}
+
+func (c Color) String() string {
+	switch c {
+	case Black:
+		return "black"
+	case White:
+		return "white"
+	default:
+		return ""
+	}
+}
+
+// ParseColor is the inverse of String; anything else is Empty.
+func ParseColor(s string) Color {
+	switch s {
+	case "black":
+		return Black
+	case "white":
+		return White
+	default:
+		return Empty
+	}
+}
+
+// Point is an intersection, with 0,0 in the top left corner.
+type Point struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+var (
+	ErrOutOfBounds = errors.New("point is off the board")
+	ErrOccupied    = errors.New("point is already occupied")
+	ErrSuicide     = errors.New("move would be suicide")
+	ErrKo          = errors.New("move retakes a ko")
+	ErrWrongTurn   = errors.New("not this player's turn")
+)
+
+// Board is a position together with the state needed to continue the game
+// from it: captures so far, the ko point and the player to move.
+type Board struct {
+	size     int
+	grid     []Color
+	captures [3]int // Indexed by Color: stones captured by that player
+	ko       *Point
+	next     Color
+	moves    int
+}
+
+// NewBoard returns an empty board with Black to move.
+func NewBoard(size int) *Board {
+	return &Board{
+		size: size,
+		grid: make([]Color, size*size),
+		next: Black,
+	}
+}
+
+// Size returns the number of lines on each side of the board.
+func (b *Board) Size() int {
+	return b.size
+}
+
+// At returns the stone at x,y, or Empty for an empty or off-board point.
+func (b *Board) At(x, y int) Color {
+	if !b.onBoard(x, y) {
+		return Empty
+	}
+	return b.grid[y*b.size+x]
+}
+
+// Next returns the player to move.
+func (b *Board) Next() Color {
+	return b.next
+}
+
+// SetNext overrides the player to move, e.g. after handicap stones.
+func (b *Board) SetNext(c Color) {
+	b.next = c
+}
+
+// MoveCount returns the number of moves and passes played.
+func (b *Board) MoveCount() int {
+	return b.moves
+}
+
+// Captures returns the number of stones captured by c.
+func (b *Board) Captures(c Color) int {
+	return b.captures[c]
+}
+
+// Ko returns the point that may not be played on the next move, if any.
+func (b *Board) Ko() (Point, bool) {
+	if b.ko == nil {
+		return Point{}, false
+	}
+	return *b.ko, true
+}
+
+// Grid returns the position as rows of "black", "white" or "" strings,
+// indexed [y][x].
+func (b *Board) Grid() [][]string {
+	rows := make([][]string, b.size)
+	for y := range rows {
+		rows[y] = make([]string, b.size)
+		for x := range rows[y] {
+			rows[y][x] = b.At(x, y).String()
+		}
+	}
+	return rows
+}
+
+// Clone returns an independent copy of the board.
+func (b *Board) Clone() *Board {
+	c := *b
+	c.grid = append([]Color(nil), b.grid...)
+	if b.ko != nil {
+		ko := *b.ko
+		c.ko = &ko
+	}
+	return &c
+}
+
+// Play places a stone of color c at x,y, removes any captured stones and
+// returns how many were captured. The board is unchanged on error.
+func (b *Board) Play(c Color, x, y int) (int, error) {
+	if c != b.next {
+		return 0, ErrWrongTurn
+	}
+	if !b.onBoard(x, y) {
+		return 0, ErrOutOfBounds
+	}
+	if b.At(x, y) != Empty {
+		return 0, ErrOccupied
+	}
+	if b.ko != nil && b.ko.X == x && b.ko.Y == y {
+		return 0, ErrKo
+	}
+
+	b.set(x, y, c)
+
+	var captured []Point
+	for _, n := range b.neighbors(x, y) {
+		if b.At(n.X, n.Y) == c.Opponent() {
+			group, liberties := b.group(n.X, n.Y)
+			if liberties == 0 {
+				for _, p := range group {
+					b.set(p.X, p.Y, Empty)
+				}
+				captured = append(captured, group...)
+			}
+		}
+	}
+
+	group, liberties := b.group(x, y)
+	if liberties == 0 {
+		b.set(x, y, Empty)
+		return 0, ErrSuicide
+	}
+
+	// A single stone capturing a single stone creates a ko
+	b.ko = nil
+	if len(captured) == 1 && len(group) == 1 && liberties == 1 {
+		ko := captured[0]
+		b.ko = &ko
+	}
+
+	b.captures[c] += len(captured)
+	b.next = c.Opponent()
+	b.moves++
+	return len(captured), nil
+}
+
+// Pass records a pass by c.
+func (b *Board) Pass(c Color) error {
+	if c != b.next {
+		return ErrWrongTurn
+	}
+	b.ko = nil
+	b.next = c.Opponent()
+	b.moves++
+	return nil
+}
+
+// Place puts a stone on the board without checking turn, captures or ko, as
+// for handicap or setup stones. Placing Empty removes a stone.
+func (b *Board) Place(c Color, x, y int) error {
+	if !b.onBoard(x, y) {
+		return ErrOutOfBounds
+	}
+	b.set(x, y, c)
+	b.ko = nil
+	return nil
+}
+
+func (b *Board) onBoard(x, y int) bool {
+	return x >= 0 && y >= 0 && x < b.size && y < b.size
+}
+
+func (b *Board) set(x, y int, c Color) {
+	b.grid[y*b.size+x] = c
+}
+
+func (b *Board) neighbors(x, y int) []Point {
+	points := make([]Point, 0, 4)
+	for _, d := range [4]Point{{0, -1}, {1, 0}, {0, 1}, {-1, 0}} {
+		if b.onBoard(x+d.X, y+d.Y) {
+			points = append(points, Point{x + d.X, y + d.Y})
+		}
+	}
+	return points
+}
+
+// group returns the stones connected to x,y and their number of liberties.
+func (b *Board) group(x, y int) ([]Point, int) {
+	color := b.At(x, y)
+	seen := map[Point]bool{{x, y}: true}
+	liberties := map[Point]bool{}
+	stack := []Point{{x, y}}
+	var stones []Point
+
+	for len(stack) > 0 {
+		p := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		stones = append(stones, p)
+
+		for _, n := range b.neighbors(p.X, p.Y) {
+			switch b.At(n.X, n.Y) {
+			case Empty:
+				liberties[n] = true
+			case color:
+				if !seen[n] {
+					seen[n] = true
+					stack = append(stack, n)
+				}
+			}
+		}
+	}
+	return stones, len(liberties)
+}
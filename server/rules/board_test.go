@@ -0,0 +1,295 @@
+package rules
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// boardFrom builds a board from rows of X (black), O (white) and . (empty),
+// with next to move.
+func boardFrom(t *testing.T, next Color, rows ...string) *Board {
+	t.Helper()
+	b := NewBoard(len(rows))
+	for y, row := range rows {
+		if len(row) != len(rows) {
+			t.Fatalf("row %d has %d points, want %d", y, len(row), len(rows))
+		}
+		for x, r := range row {
+			switch r {
+			case 'X':
+				b.Place(Black, x, y)
+			case 'O':
+				b.Place(White, x, y)
+			}
+		}
+	}
+	b.SetNext(next)
+	return b
+}
+
+// rowsOf is the inverse of boardFrom.
+func rowsOf(b *Board) []string {
+	rows := make([]string, b.Size())
+	for y := range rows {
+		var row strings.Builder
+		for x := range b.Size() {
+			switch b.At(x, y) {
+			case Black:
+				row.WriteByte('X')
+			case White:
+				row.WriteByte('O')
+			default:
+				row.WriteByte('.')
+			}
+		}
+		rows[y] = row.String()
+	}
+	return rows
+}
+
+func TestPlay(t *testing.T) {
+	tests := []struct {
+		name     string
+		board    []string
+		color    Color
+		x, y     int
+		err      error
+		captured int
+		want     []string // Board afterwards; unchanged if nil
+	}{
+		{
+			name:  "plain move",
+			board: []string{"...", "...", "..."},
+			color: Black, x: 1, y: 1,
+			want: []string{"...", ".X.", "..."},
+		},
+		{
+			name:  "single stone capture in the corner",
+			board: []string{"XO.", "...", "..."},
+			color: White, x: 0, y: 1,
+			captured: 1,
+			want:     []string{".O.", "O..", "..."},
+		},
+		{
+			name:  "multi-stone capture",
+			board: []string{"XXO.", "O...", "....", "...."},
+			color: White, x: 1, y: 1,
+			captured: 2,
+			want:     []string{"..O.", "OO..", "....", "...."},
+		},
+		{
+			name:  "several groups captured at once",
+			board: []string{"X.XO", "OXO.", ".O..", "...."},
+			color: White, x: 1, y: 0,
+			captured: 3,
+			want:     []string{".O.O", "O.O.", ".O..", "...."},
+		},
+		{
+			name:  "filling a last liberty is allowed when it captures",
+			board: []string{".OX.", "OX..", "X...", "...."},
+			color: Black, x: 0, y: 0,
+			captured: 2,
+			want:     []string{"X.X.", ".X..", "X...", "...."},
+		},
+		{
+			name:  "single stone suicide",
+			board: []string{".O.", "O..", "..."},
+			color: Black, x: 0, y: 0,
+			err: ErrSuicide,
+		},
+		{
+			name:  "multi-stone suicide",
+			board: []string{"X.O.", "OO..", "....", "...."},
+			color: Black, x: 1, y: 0,
+			err: ErrSuicide,
+		},
+		{
+			name:  "occupied point",
+			board: []string{"...", ".O.", "..."},
+			color: Black, x: 1, y: 1,
+			err: ErrOccupied,
+		},
+		{
+			name:  "left of the board",
+			board: []string{"...", "...", "..."},
+			color: Black, x: -1, y: 0,
+			err: ErrOutOfBounds,
+		},
+		{
+			name:  "below the board",
+			board: []string{"...", "...", "..."},
+			color: Black, x: 0, y: 3,
+			err: ErrOutOfBounds,
+		},
+		{
+			name:  "out of turn",
+			board: []string{"...", "...", "..."},
+			color: White, x: 1, y: 1,
+			err: ErrWrongTurn,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := boardFrom(t, Black, tt.board...)
+			if tt.color == White && tt.err != ErrWrongTurn {
+				b.SetNext(White)
+			}
+
+			captured, err := b.Play(tt.color, tt.x, tt.y)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Play() error = %v, want %v", err, tt.err)
+			}
+			if captured != tt.captured {
+				t.Errorf("Play() captured %d, want %d", captured, tt.captured)
+			}
+			if b.Captures(tt.color) != tt.captured {
+				t.Errorf("Captures(%s) = %d, want %d", tt.color, b.Captures(tt.color), tt.captured)
+			}
+
+			want := tt.want
+			if want == nil {
+				want = tt.board
+			}
+			if got := rowsOf(b); strings.Join(got, "/") != strings.Join(want, "/") {
+				t.Errorf("board = %v, want %v", got, want)
+			}
+
+			wantNext := tt.color.Opponent()
+			if tt.err != nil {
+				wantNext = tt.color
+				if tt.err == ErrWrongTurn {
+					wantNext = Black
+				}
+			}
+			if b.Next() != wantNext {
+				t.Errorf("Next() = %s, want %s", b.Next(), wantNext)
+			}
+		})
+	}
+}
+
+func TestKo(t *testing.T) {
+	// Black takes the white stone at 1,1 by playing 2,1
+	b := boardFrom(t, Black,
+		".XO..",
+		"XO.O.",
+		".XO..",
+		".....",
+		".....",
+	)
+	if _, err := b.Play(Black, 2, 1); err != nil {
+		t.Fatalf("taking the ko: %v", err)
+	}
+	if ko, ok := b.Ko(); !ok || ko != (Point{X: 1, Y: 1}) {
+		t.Fatalf("Ko() = %v, %v; want 1,1", ko, ok)
+	}
+
+	// White may not retake straight away
+	if _, err := b.Play(White, 1, 1); !errors.Is(err, ErrKo) {
+		t.Fatalf("immediate retake error = %v, want %v", err, ErrKo)
+	}
+
+	// After a move elsewhere by each player the ko may be retaken
+	if _, err := b.Play(White, 4, 4); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := b.Ko(); ok {
+		t.Error("ko still set after a move elsewhere")
+	}
+	if _, err := b.Play(Black, 4, 0); err != nil {
+		t.Fatal(err)
+	}
+	captured, err := b.Play(White, 1, 1)
+	if err != nil {
+		t.Fatalf("retaking the ko later: %v", err)
+	}
+	if captured != 1 || b.At(2, 1) != Empty {
+		t.Errorf("retake captured %d, stone at 2,1 is %s", captured, b.At(2, 1))
+	}
+	if ko, ok := b.Ko(); !ok || ko != (Point{X: 2, Y: 1}) {
+		t.Errorf("Ko() after retake = %v, %v; want 2,1", ko, ok)
+	}
+
+	// A pass also lifts the ko
+	if err := b.Pass(Black); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := b.Ko(); ok {
+		t.Error("ko still set after a pass")
+	}
+}
+
+func TestMultiStoneCaptureSetsNoKo(t *testing.T) {
+	// Capturing two stones with one never sets a ko
+	b := boardFrom(t, White,
+		"XXO.",
+		"O...",
+		"....",
+		"....",
+	)
+	if _, err := b.Play(White, 1, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := b.Ko(); ok {
+		t.Error("ko set after a two-stone capture")
+	}
+}
+
+func TestTurnOrder(t *testing.T) {
+	b := NewBoard(9)
+	if b.Next() != Black {
+		t.Fatalf("first player = %s, want black", b.Next())
+	}
+	if _, err := b.Play(Black, 2, 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Play(Black, 3, 3); !errors.Is(err, ErrWrongTurn) {
+		t.Errorf("second black move error = %v, want %v", err, ErrWrongTurn)
+	}
+	if err := b.Pass(Black); !errors.Is(err, ErrWrongTurn) {
+		t.Errorf("black pass out of turn error = %v, want %v", err, ErrWrongTurn)
+	}
+	if err := b.Pass(White); err != nil {
+		t.Fatal(err)
+	}
+	if b.Next() != Black || b.MoveCount() != 2 {
+		t.Errorf("after a pass: Next() = %s, MoveCount() = %d; want black, 2", b.Next(), b.MoveCount())
+	}
+
+	// Setup stones do not take a turn
+	if err := b.Place(White, 4, 4); err != nil {
+		t.Fatal(err)
+	}
+	if b.Next() != Black || b.MoveCount() != 2 {
+		t.Errorf("after Place: Next() = %s, MoveCount() = %d; want black, 2", b.Next(), b.MoveCount())
+	}
+}
+
+func TestPlace(t *testing.T) {
+	b := NewBoard(5)
+	if err := b.Place(Black, 5, 0); !errors.Is(err, ErrOutOfBounds) {
+		t.Errorf("Place off the board error = %v, want %v", err, ErrOutOfBounds)
+	}
+	if err := b.Place(Black, 2, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Place(Empty, 2, 2); err != nil {
+		t.Fatal(err)
+	}
+	if b.At(2, 2) != Empty {
+		t.Errorf("stone not removed by placing Empty")
+	}
+}
+
+func TestCloneIsIndependent(t *testing.T) {
+	b := NewBoard(5)
+	c := b.Clone()
+	if _, err := c.Play(Black, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if b.At(0, 0) != Empty || b.Next() != Black {
+		t.Error("playing on a clone changed the original")
+	}
+}
@@ -0,0 +1,57 @@
+package sgf
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// Charset returns the charset declared with CA in the root node of the
+// first game of data, or "" if there is none. Only the root node is read,
+// so text later in the file cannot get in the way.
+func Charset(data []byte) string {
+	p := &parser{data: data, line: 1, column: 1}
+	for {
+		c, ok := p.peek()
+		if !ok {
+			return ""
+		}
+		p.next()
+		if c == '(' {
+			break
+		}
+	}
+	p.skipSpace()
+	if c, ok := p.peek(); !ok || c != ';' {
+		return ""
+	}
+	root, err := p.parseNode()
+	if err != nil {
+		return ""
+	}
+	charset, _ := root.Get("CA")
+	return strings.TrimSpace(charset)
+}
+
+// Decode converts data from charset, as named by CA, to UTF-8. Files that
+// declare no charset or claim UTF-8 are kept if they are valid UTF-8 and
+// otherwise read as Latin-1, the FF[4] default. Any charset known to web
+// browsers is understood; others are an error.
+func Decode(data []byte, charset string) ([]byte, error) {
+	if charset == "" {
+		charset = "utf-8"
+	}
+	encoding, err := htmlindex.Get(charset)
+	if err != nil {
+		return nil, fmt.Errorf("unknown charset %q", charset)
+	}
+	if name, _ := htmlindex.Name(encoding); name == "utf-8" {
+		if utf8.Valid(data) {
+			return data, nil
+		}
+		encoding, _ = htmlindex.Get("iso-8859-1")
+	}
+	return encoding.NewDecoder().Bytes(data)
+}
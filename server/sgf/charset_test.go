@@ -0,0 +1,52 @@
+package sgf
+
+import "testing"
+
+func TestCharset(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"(;FF[4]CA[Shift_JIS]GN[x])", "Shift_JIS"},
+		{"(;FF[4]CA[ UTF-8 ])", "UTF-8"},
+		{"(;FF[4];C[CA[GB2312]])", ""},
+		{"(;FF[4])(;CA[Big5])", ""},
+		{"no game", ""},
+	}
+	for _, tt := range tests {
+		if got := Charset([]byte(tt.input)); got != tt.want {
+			t.Errorf("Charset(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   []byte
+		charset string
+		want    string
+		err     bool
+	}{
+		{"UTF-8 kept", []byte("Café"), "", "Café", false},
+		{"declared UTF-8 kept", []byte("Café"), "utf-8", "Café", false},
+		{"Latin-1 without a charset", []byte("Caf\xe9"), "", "Café", false},
+		{"Latin-1 claiming UTF-8", []byte("Caf\xe9"), "UTF-8", "Café", false},
+		{"declared Latin-1", []byte("Caf\xe9"), "ISO-8859-1", "Café", false},
+		{"Shift_JIS", []byte("\x8c\xe9"), "Shift_JIS", "碁", false},
+		{"GB2312", []byte("\xce\xa7\xc6\xe5"), "GB2312", "围棋", false},
+		{"EUC-KR", []byte("\xb9\xd9\xb5\xcf"), "EUC-KR", "바둑", false},
+		{"unknown charset", []byte("x"), "klingon", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decode(tt.input, tt.charset)
+			if (err != nil) != tt.err {
+				t.Fatalf("Decode() error = %v, want error %v", err, tt.err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Decode() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,288 @@
+package sgf
+
+import (
+	"fmt"
+	"strings"
+
+	"frogs_cafe/rules"
+)
+
+// SyntaxError reports where an SGF file stops making sense.
+type SyntaxError struct {
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Msg)
+}
+
+// Parse reads an SGF collection and returns the root node of each game
+// tree in it. Anything before the first "(" is ignored, as the
+// specification requires. Errors are *SyntaxError.
+func Parse(data []byte) ([]*Node, error) {
+	p := &parser{data: data, line: 1, column: 1}
+
+	for {
+		c, ok := p.peek()
+		if !ok || c == '(' {
+			break
+		}
+		p.next()
+	}
+	if _, ok := p.peek(); !ok {
+		return nil, p.errorf("no game tree found")
+	}
+
+	var trees []*Node
+	for {
+		p.skipSpace()
+		c, ok := p.peek()
+		if !ok {
+			return trees, nil
+		}
+		if c != '(' {
+			return nil, p.errorf("expected '(' but found %q", c)
+		}
+		tree, err := p.parseTree()
+		if err != nil {
+			return nil, err
+		}
+		trees = append(trees, tree)
+	}
+}
+
+type parser struct {
+	data   []byte
+	pos    int
+	line   int
+	column int
+}
+
+func (p *parser) peek() (byte, bool) {
+	if p.pos >= len(p.data) {
+		return 0, false
+	}
+	return p.data[p.pos], true
+}
+
+func (p *parser) next() byte {
+	c := p.data[p.pos]
+	p.pos++
+	if c == '\n' {
+		p.line++
+		p.column = 1
+	} else {
+		p.column++
+	}
+	return c
+}
+
+func (p *parser) skipSpace() {
+	for {
+		c, ok := p.peek()
+		if !ok || (c != ' ' && c != '\t' && c != '\n' && c != '\r' && c != '\v' && c != '\f') {
+			return
+		}
+		p.next()
+	}
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return &SyntaxError{Line: p.line, Column: p.column, Msg: fmt.Sprintf(format, args...)}
+}
+
+// parseTree reads "(" Sequence GameTree* ")". The nodes of the sequence are
+// chained as first children; nested trees become children of the last one.
+func (p *parser) parseTree() (*Node, error) {
+	p.next() // (
+	p.skipSpace()
+	if c, ok := p.peek(); !ok || c != ';' {
+		return nil, p.unexpected("';' to start a node")
+	}
+
+	var root, last *Node
+	for {
+		p.skipSpace()
+		c, ok := p.peek()
+		if !ok || c != ';' {
+			break
+		}
+		node, err := p.parseNode()
+		if err != nil {
+			return nil, err
+		}
+		if root == nil {
+			root = node
+		} else {
+			last.AddChild(node)
+		}
+		last = node
+	}
+
+	for {
+		p.skipSpace()
+		c, ok := p.peek()
+		if !ok {
+			return nil, p.errorf("unexpected end of file, missing ')'")
+		}
+		switch c {
+		case '(':
+			child, err := p.parseTree()
+			if err != nil {
+				return nil, err
+			}
+			last.AddChild(child)
+		case ')':
+			p.next()
+			return root, nil
+		default:
+			return nil, p.unexpected("'(' or ')'")
+		}
+	}
+}
+
+// parseNode reads ";" Property*.
+func (p *parser) parseNode() (*Node, error) {
+	p.next() // ;
+	node := &Node{}
+	for {
+		p.skipSpace()
+		c, ok := p.peek()
+		if !ok || !isLetter(c) {
+			return node, nil
+		}
+
+		line, column := p.line, p.column
+		var id strings.Builder
+		for ok && isLetter(c) {
+			// Older files spell identifiers with lowercase letters mixed
+			// in (CoPyright for CP); only the capitals count
+			if c >= 'A' && c <= 'Z' {
+				id.WriteByte(c)
+			}
+			p.next()
+			c, ok = p.peek()
+		}
+		if id.Len() == 0 {
+			return nil, &SyntaxError{Line: line, Column: column, Msg: "property identifier has no capital letters"}
+		}
+
+		p.skipSpace()
+		if c, ok := p.peek(); !ok || c != '[' {
+			return nil, p.unexpected(fmt.Sprintf("'[' after property %s", id.String()))
+		}
+		var values []string
+		for {
+			p.skipSpace()
+			if c, ok := p.peek(); !ok || c != '[' {
+				break
+			}
+			value, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		node.Add(id.String(), values...)
+	}
+}
+
+// parseValue reads "[" value "]", resolving escapes. An escaped line break
+// is a soft break and is removed.
+func (p *parser) parseValue() (string, error) {
+	line, column := p.line, p.column
+	p.next() // [
+
+	var value strings.Builder
+	for {
+		c, ok := p.peek()
+		if !ok {
+			return "", &SyntaxError{Line: line, Column: column, Msg: "value is never closed with ']'"}
+		}
+		p.next()
+		switch c {
+		case ']':
+			return value.String(), nil
+		case '\\':
+			escaped, ok := p.peek()
+			if !ok {
+				continue
+			}
+			p.next()
+			if escaped == '\r' || escaped == '\n' {
+				// Swallow the other half of a CRLF or LFCR pair
+				if other, ok := p.peek(); ok && (other == '\r' || other == '\n') && other != escaped {
+					p.next()
+				}
+				continue
+			}
+			value.WriteByte(escaped)
+		default:
+			value.WriteByte(c)
+		}
+	}
+}
+
+// unexpected reports the byte at the current position, or the end of file.
+func (p *parser) unexpected(want string) error {
+	c, ok := p.peek()
+	if !ok {
+		return p.errorf("unexpected end of file, expected %s", want)
+	}
+	return p.errorf("expected %s but found %q", want, c)
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z')
+}
+
+// ParseMove decodes the value of a B or W property on a board of the given
+// size. An empty value, or "tt" on boards up to 19x19, is a pass.
+func ParseMove(value string, size int) (rules.Point, bool, error) {
+	if value == "" || (value == "tt" && size <= 19) {
+		return rules.Point{}, true, nil
+	}
+	point, err := ParsePoint(value, size)
+	return point, false, err
+}
+
+// ParsePoint decodes a two-letter point on a board of the given size.
+func ParsePoint(value string, size int) (rules.Point, error) {
+	if len(value) != 2 {
+		return rules.Point{}, fmt.Errorf("invalid point %q", value)
+	}
+	x := strings.IndexByte(coordinates, value[0])
+	y := strings.IndexByte(coordinates, value[1])
+	if x < 0 || y < 0 || x >= size || y >= size {
+		return rules.Point{}, fmt.Errorf("point %q is off a %dx%d board", value, size, size)
+	}
+	return rules.Point{X: x, Y: y}, nil
+}
+
+// ParsePointList decodes the values of a setup property such as AB, where
+// "aa:cc" stands for every point of the rectangle between the two corners.
+func ParsePointList(values []string, size int) ([]rules.Point, error) {
+	var points []rules.Point
+	for _, value := range values {
+		from, to, isRange := strings.Cut(value, ":")
+		if !isRange {
+			to = from
+		}
+		a, err := ParsePoint(from, size)
+		if err != nil {
+			return nil, err
+		}
+		b, err := ParsePoint(to, size)
+		if err != nil {
+			return nil, err
+		}
+		for y := min(a.Y, b.Y); y <= max(a.Y, b.Y); y++ {
+			for x := min(a.X, b.X); x <= max(a.X, b.X); x++ {
+				points = append(points, rules.Point{X: x, Y: y})
+			}
+		}
+	}
+	return points, nil
+}
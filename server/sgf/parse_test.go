@@ -0,0 +1,240 @@
+package sgf
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"frogs_cafe/rules"
+)
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name         string
+		input        string
+		line, column int
+		msg          string
+	}{
+		{"empty file", "", 1, 1, "no game tree found"},
+		{"no game tree", "just text", 1, 10, "no game tree found"},
+		{"tree without a node", "(B[aa])", 1, 2, "expected ';' to start a node"},
+		{"property without a value", "(;B aa)", 1, 5, "expected '[' after property B"},
+		{"lowercase identifier", "(;GM[1]\n  ;b[aa])", 2, 4, "property identifier has no capital letters"},
+		{"unclosed value", "(;GM[1]\n;C[oops\n", 2, 3, "value is never closed with ']'"},
+		{"unclosed tree", "(;B[aa]", 1, 8, "unexpected end of file, missing ')'"},
+		{"junk inside a tree", "(;B[aa];W[bb]!)", 1, 14, "expected '(' or ')' but found '!'"},
+		{"junk between trees", "(;B[aa])\n x", 2, 2, "expected '(' but found 'x'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.input))
+			var syntaxErr *SyntaxError
+			if !errors.As(err, &syntaxErr) {
+				t.Fatalf("Parse() error = %v, want a *SyntaxError", err)
+			}
+			if syntaxErr.Line != tt.line || syntaxErr.Column != tt.column {
+				t.Errorf("error at line %d, column %d; want line %d, column %d", syntaxErr.Line, syntaxErr.Column, tt.line, tt.column)
+			}
+			if !strings.Contains(syntaxErr.Msg, tt.msg) {
+				t.Errorf("message = %q, want it to contain %q", syntaxErr.Msg, tt.msg)
+			}
+		})
+	}
+}
+
+func TestParseValues(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		id    string
+		want  []string
+	}{
+		{"escaped bracket and backslash", `(;C[a \] b \\ c])`, "C", []string{`a ] b \ c`}},
+		{"escaped ordinary character", `(;C[\a\b])`, "C", []string{"ab"}},
+		{"soft line break", "(;C[one \\\ntwo])", "C", []string{"one two"}},
+		{"soft CRLF line break", "(;C[one \\\r\ntwo])", "C", []string{"one two"}},
+		{"soft LFCR line break", "(;C[one \\\n\rtwo])", "C", []string{"one two"}},
+		{"hard line break kept", "(;C[one\ntwo])", "C", []string{"one\ntwo"}},
+		{"several values", "(;AB[aa] [bb]\n[cc])", "AB", []string{"aa", "bb", "cc"}},
+		{"empty value", "(;B[])", "B", []string{""}},
+		{"old style identifier", "(;CoPyright[me])", "CP", []string{"me"}},
+		{"text before the collection", "junk (;GN[x])", "GN", []string{"x"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trees, err := Parse([]byte(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := trees[0].Values(tt.id); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s = %q, want %q", tt.id, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseVariations(t *testing.T) {
+	trees, err := Parse([]byte("(;GM[1];B[aa](;W[bb];B[cc])(;W[dd]))(;GM[1])"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trees) != 2 {
+		t.Fatalf("parsed %d trees, want 2", len(trees))
+	}
+
+	root := trees[0]
+	if len(root.Children) != 1 {
+		t.Fatalf("root has %d children, want 1", len(root.Children))
+	}
+	black := root.Children[0]
+	if move, _ := black.Get("B"); move != "aa" {
+		t.Fatalf("first move = %q, want aa", move)
+	}
+	if len(black.Children) != 2 {
+		t.Fatalf("%d variations after the first move, want 2", len(black.Children))
+	}
+
+	// The first variation is the main line
+	main, side := black.Children[0], black.Children[1]
+	if move, _ := main.Get("W"); move != "bb" {
+		t.Errorf("main line reply = %q, want bb", move)
+	}
+	if len(main.Children) != 1 || len(main.Children[0].Children) != 0 {
+		t.Errorf("main line does not end after B[cc]")
+	}
+	if move, _ := side.Get("W"); move != "dd" || len(side.Children) != 0 {
+		t.Errorf("side variation = %q with %d children, want dd alone", move, len(side.Children))
+	}
+}
+
+func TestParseMove(t *testing.T) {
+	tests := []struct {
+		value string
+		size  int
+		want  rules.Point
+		pass  bool
+		err   bool
+	}{
+		{"dd", 19, rules.Point{X: 3, Y: 3}, false, false},
+		{"", 19, rules.Point{}, true, false},
+		{"tt", 19, rules.Point{}, true, false},
+		{"tt", 9, rules.Point{}, true, false},
+		{"tt", 21, rules.Point{X: 19, Y: 19}, false, false},
+		{"jj", 9, rules.Point{}, false, true},
+		{"d", 19, rules.Point{}, false, true},
+	}
+
+	for _, tt := range tests {
+		got, pass, err := ParseMove(tt.value, tt.size)
+		if (err != nil) != tt.err {
+			t.Errorf("ParseMove(%q, %d) error = %v, want error %v", tt.value, tt.size, err, tt.err)
+			continue
+		}
+		if got != tt.want || pass != tt.pass {
+			t.Errorf("ParseMove(%q, %d) = %v, %v; want %v, %v", tt.value, tt.size, got, pass, tt.want, tt.pass)
+		}
+	}
+}
+
+func TestParsePoint(t *testing.T) {
+	if p, err := ParsePoint("zA", 52); err != nil || p != (rules.Point{X: 25, Y: 26}) {
+		t.Errorf("ParsePoint(zA) = %v, %v; want 25,26", p, err)
+	}
+	if _, err := ParsePoint("A1", 52); err == nil {
+		t.Error("ParsePoint accepted a digit")
+	}
+}
+
+func TestParsePointList(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		want   []rules.Point
+		err    bool
+	}{
+		{
+			name:   "single points",
+			values: []string{"aa", "cb"},
+			want:   []rules.Point{{X: 0, Y: 0}, {X: 2, Y: 1}},
+		},
+		{
+			name:   "compressed rectangle",
+			values: []string{"aa:bc"},
+			want:   []rules.Point{{X: 0, Y: 0}, {X: 1, Y: 0}, {X: 0, Y: 1}, {X: 1, Y: 1}, {X: 0, Y: 2}, {X: 1, Y: 2}},
+		},
+		{
+			name:   "corners in either order",
+			values: []string{"ba:ab"},
+			want:   []rules.Point{{X: 0, Y: 0}, {X: 1, Y: 0}, {X: 0, Y: 1}, {X: 1, Y: 1}},
+		},
+		{
+			name:   "line",
+			values: []string{"dd:df", "aa"},
+			want:   []rules.Point{{X: 3, Y: 3}, {X: 3, Y: 4}, {X: 3, Y: 5}, {X: 0, Y: 0}},
+		},
+		{
+			name:   "range off the board",
+			values: []string{"aa:jj"},
+			err:    true,
+		},
+		{
+			name:   "malformed corner",
+			values: []string{"aa:b"},
+			err:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePointList(tt.values, 9)
+			if (err != nil) != tt.err {
+				t.Fatalf("ParsePointList() error = %v, want error %v", err, tt.err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParsePointList() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	root := &Node{}
+	root.Add("FF", "4")
+	root.Add("GM", "1")
+	root.Add("SZ", "19")
+	root.Add("GN", `Tricky ] and \ characters`)
+	root.Add("AB", "dd", "pp")
+	root.Add("C", "Two\nlines")
+	move := root.AddChild(&Node{})
+	move.Add("B", "pd")
+	main := move.AddChild(&Node{})
+	main.Add("W", "dp")
+	main.AddChild(&Node{}).Add("B", "")
+	side := move.AddChild(&Node{})
+	side.Add("W", "qq")
+	side.Add("C", "A variation")
+	// A property with no values is written with an empty one
+	tenuki := &Node{}
+	tenuki.Add("TE")
+	side.AddChild(tenuki)
+	other := &Node{}
+	other.Add("GM", "1")
+
+	var encoded bytes.Buffer
+	if err := Encode(&encoded, root, other); err != nil {
+		t.Fatal(err)
+	}
+	trees, err := Parse(encoded.Bytes())
+	if err != nil {
+		t.Fatalf("Parse(Encode()) failed: %v\n%s", err, encoded.String())
+	}
+
+	tenuki.Properties[0].Values = []string{""}
+	if want := []*Node{root, other}; !reflect.DeepEqual(trees, want) {
+		t.Errorf("round trip changed the collection:\n%s", encoded.String())
+	}
+}
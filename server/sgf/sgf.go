@@ -0,0 +1,132 @@
+// Package sgf reads and writes game records in the Smart Game Format
+// (FF[4], https://www.red-bean.com/sgf/). A record is a tree of nodes;
+// the first child of every node is the main line and any further children
+// are variations.
+package sgf
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// Property is one property of a node with its values, e.g. AB[dd][pp].
+type Property struct {
+	ID     string
+	Values []string
+}
+
+// Node is a node of a game tree.
+type Node struct {
+	Properties []Property
+	Children   []*Node
+}
+
+// Add appends values to property id, creating it if needed.
+func (n *Node) Add(id string, values ...string) {
+	for i := range n.Properties {
+		if n.Properties[i].ID == id {
+			n.Properties[i].Values = append(n.Properties[i].Values, values...)
+			return
+		}
+	}
+	n.Properties = append(n.Properties, Property{ID: id, Values: values})
+}
+
+// Values returns every value of property id.
+func (n *Node) Values(id string) []string {
+	for _, p := range n.Properties {
+		if p.ID == id {
+			return p.Values
+		}
+	}
+	return nil
+}
+
+// Get returns the first value of property id.
+func (n *Node) Get(id string) (string, bool) {
+	values := n.Values(id)
+	if len(values) == 0 {
+		return "", false
+	}
+	return values[0], true
+}
+
+// AddChild appends child to n and returns it, so a main line can be built
+// by chaining.
+func (n *Node) AddChild(child *Node) *Node {
+	n.Children = append(n.Children, child)
+	return child
+}
+
+// coordinates are the letters used for board lines: a-z, then A-Z for
+// boards larger than 26.
+const coordinates = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// MaxBoardSize is the largest board SGF coordinates can address.
+const MaxBoardSize = len(coordinates)
+
+// Point encodes the intersection at column x, row y (0,0 is top left).
+func Point(x, y int) string {
+	return string(coordinates[x]) + string(coordinates[y])
+}
+
+// Encode writes trees as an SGF collection. Each node of a main line goes
+// on its own line.
+func Encode(w io.Writer, trees ...*Node) error {
+	bw := bufio.NewWriter(w)
+	for _, tree := range trees {
+		writeTree(bw, tree)
+		bw.WriteString("\n")
+	}
+	return bw.Flush()
+}
+
+// writeTree writes the sequence starting at node, then its variations.
+func writeTree(w *bufio.Writer, node *Node) {
+	w.WriteString("(")
+	for {
+		writeNode(w, node)
+		if len(node.Children) != 1 {
+			break
+		}
+		node = node.Children[0]
+		w.WriteString("\n")
+	}
+	for _, child := range node.Children {
+		w.WriteString("\n")
+		writeTree(w, child)
+	}
+	w.WriteString(")")
+}
+
+func writeNode(w *bufio.Writer, node *Node) {
+	w.WriteString(";")
+	for _, p := range node.Properties {
+		w.WriteString(p.ID)
+		if len(p.Values) == 0 {
+			// Every property needs at least one value, if only an empty one
+			w.WriteString("[]")
+		}
+		for _, v := range p.Values {
+			w.WriteString("[")
+			w.WriteString(escape(v))
+			w.WriteString("]")
+		}
+	}
+}
+
+// escape protects the characters SGF treats specially inside a value.
+func escape(v string) string {
+	if !strings.ContainsAny(v, `]\`) {
+		return v
+	}
+	var b strings.Builder
+	for _, r := range v {
+		if r == ']' || r == '\\' {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -1,7 +1,7 @@
 import React, { useEffect, useState, useRef } from "react";
-import { Game } from "../types";
+import { Game, GameStateData } from "../types";
 import { useAuth } from "../contexts/AuthContext";
-import { API_URL, WS_URL } from "../config";
+import { WS_URL } from "../config";
 import "./GameBoard.css";
 
 interface GameBoardProps {
@@ -42,34 +42,14 @@ const GameBoard: React.FC<GameBoardProps> = ({ game }) => {
   };
 
   useEffect(() => {
-    // Initialize empty board
-    const newBoard = Array(game.board_size)
-      .fill(null)
-      .map(() => Array(game.board_size).fill(null));
-
-    // Load existing moves from the server
-    fetch(`${API_URL}/api/v1/games/${game.id}/moves`)
-      .then((res) => res.json())
-      .then((moves) => {
-        if (moves && Array.isArray(moves)) {
-          moves.forEach((move: any) => {
-            // Determine color based on which player made the move
-            const color = getColorForPlayer(move.player_id);
-            if (color) {
-              newBoard[move.y][move.x] = color;
-            }
-          });
-          setMoveCount(moves.length);
-        } else {
-          console.warn("Moves data is not an array:", moves);
-          setMoveCount(0);
-        }
-      })
-      .catch((err) => console.error("Error loading moves:", err))
-      .finally(() => {
-        // Always set the board, even if fetch fails
-        setBoard(newBoard);
-      });
+    // Start from an empty board; the server sends the current position in a
+    // game_state message as soon as the WebSocket subscribes to the game
+    setBoard(
+      Array(game.board_size)
+        .fill(null)
+        .map(() => Array(game.board_size).fill(null)),
+    );
+    setMoveCount(0);
 
     // Connect to WebSocket for all users (authenticated and guests)
     // Token is optional - guests can watch games without authentication
@@ -86,10 +66,22 @@ const GameBoard: React.FC<GameBoardProps> = ({ game }) => {
     websocket.onmessage = (event) => {
       const message = JSON.parse(event.data);
 
+      // Full snapshot of the game, sent when we start following it
+      if (message.type === "game_state" && message.data) {
+        const state = message.data as GameStateData;
+        setCurrentGame(state.game);
+        setBoard(
+          state.board.map((row) =>
+            row.map((cell) => (cell === "" ? null : cell)),
+          ),
+        );
+        setMoveCount(state.moves.length);
+      }
+
       // Handle incoming moves from other players
       if (message.type === "move" && message.data) {
-        const { x, y, player_id } = message.data;
-        const color = getColorForPlayer(player_id);
+        const { x, y, player_id, move_number } = message.data;
+        const color = message.data.color ?? getColorForPlayer(player_id);
 
         if (color) {
           setBoard((prevBoard) => {
@@ -97,7 +89,7 @@ const GameBoard: React.FC<GameBoardProps> = ({ game }) => {
             newBoard[y][x] = color;
             return newBoard;
           });
-          setMoveCount((prevCount) => prevCount + 1);
+          setMoveCount(move_number);
         } else {
           console.warn(
             `Unable to place stone: player ${player_id} not in this game`,
@@ -166,7 +158,14 @@ const GameBoard: React.FC<GameBoardProps> = ({ game }) => {
     if (ws && ws.readyState === WebSocket.OPEN) {
       const moveMessage = {
         type: "move",
-        data: { x, y, game_id: currentGame.id, player_id: player?.id },
+        data: {
+          x,
+          y,
+          game_id: currentGame.id,
+          player_id: player?.id,
+          // Lets the server reject the move if the board we saw is stale
+          move_number: moveCount + 1,
+        },
       };
       ws.send(JSON.stringify(moveMessage));
     }
@@ -0,0 +1,38 @@
+import { useEffect, useRef } from "react";
+import { LobbyEvent } from "../types";
+import { WS_URL } from "../config";
+
+const LOBBY_EVENT_TYPES = [
+  "game_created",
+  "game_started",
+  "game_cancelled",
+];
+
+// Subscribes to the server's lobby channel and calls onEvent for every
+// game created/started/cancelled event.
+export function useLobbyEvents(onEvent: (event: LobbyEvent) => void) {
+  // Keep the latest callback without reconnecting on every render
+  const onEventRef = useRef(onEvent);
+  useEffect(() => {
+    onEventRef.current = onEvent;
+  }, [onEvent]);
+
+  useEffect(() => {
+    const websocket = new WebSocket(`${WS_URL}/ws?lobby=true`);
+
+    websocket.onmessage = (event) => {
+      const message = JSON.parse(event.data);
+      if (LOBBY_EVENT_TYPES.includes(message.type) && message.data) {
+        onEventRef.current(message as LobbyEvent);
+      }
+    };
+
+    websocket.onerror = (error) => {
+      console.error("Lobby WebSocket error:", error);
+    };
+
+    return () => {
+      websocket.close();
+    };
+  }, []);
+}
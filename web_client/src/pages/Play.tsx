@@ -4,6 +4,7 @@ import { useAuth } from "../contexts/AuthContext";
 import GameList from "../components/GameList";
 import { Game } from "../types";
 import { API_URL } from "../config";
+import { useLobbyEvents } from "../hooks/useLobbyEvents";
 import "./Play.css";
 
 export function Play() {
@@ -17,6 +18,18 @@ export function Play() {
     fetchGames();
   }, []);
 
+  // Keep the list of open challenges live
+  useLobbyEvents((event) => {
+    const game = event.data.game;
+    if (event.type === "game_created") {
+      setGames((prev) =>
+        prev.some((g) => g.id === game.id) ? prev : [game, ...prev],
+      );
+    } else {
+      setGames((prev) => prev.filter((g) => g.id !== game.id));
+    }
+  });
+
   const fetchGames = async () => {
     try {
       setLoading(true);
@@ -55,7 +68,9 @@ export function Play() {
       }
 
       const newGame = await response.json();
-      setGames([newGame, ...games]);
+      setGames((prev) =>
+        prev.some((g) => g.id === newGame.id) ? prev : [newGame, ...prev],
+      );
     } catch (error) {
       console.error("Error creating game:", error);
       alert("Failed to create game. Please try again.");
@@ -4,6 +4,7 @@ import { useAuth } from "../contexts/AuthContext";
 import GameList from "../components/GameList";
 import { Game } from "../types";
 import { API_URL } from "../config";
+import { useLobbyEvents } from "../hooks/useLobbyEvents";
 import "./Watch.css";
 
 export function Watch() {
@@ -17,6 +18,18 @@ export function Watch() {
     fetchGames();
   }, []);
 
+  // Keep the list of ongoing games live
+  useLobbyEvents((event) => {
+    const game = event.data.game;
+    if (event.type === "game_started") {
+      setGames((prev) =>
+        prev.some((g) => g.id === game.id) ? prev : [game, ...prev],
+      );
+    } else if (event.type !== "game_created") {
+      setGames((prev) => prev.filter((g) => g.id !== game.id));
+    }
+  });
+
   const fetchGames = async () => {
     try {
       setLoading(true);
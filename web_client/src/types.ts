@@ -12,7 +12,7 @@ export interface Game {
   black_player_id: number | null;
   white_player_id: number | null;
   board_size: number;
-  status: "waiting" | "active" | "finished";
+  status: "waiting" | "active" | "finished" | "cancelled" | "imported";
   winner_id: number | null;
   creator_id: number | null;
   created_at: string;
@@ -26,12 +26,49 @@ export interface Move {
   move_number: number;
   x: number;
   y: number;
+  color?: "black" | "white";
   created_at: string;
+  annotations?: Annotation[];
+}
+
+export interface Markup {
+  type: "triangle" | "square" | "circle" | "label";
+  x: number;
+  y: number;
+  label?: string;
+}
+
+export interface Annotation {
+  id: number;
+  game_id: number;
+  move_number: number;
+  author_id: number;
+  author_name: string;
+  comment: string;
+  markup: Markup[];
+  created_at: string;
+  updated_at: string;
 }
 
 // TODO: Add proper type definitions for authenticate, auth_success, and auth_error messages (#22)
 export interface WebSocketMessage {
-  type: "move" | "game_update" | "authenticate" | "auth_success" | "auth_error";
+  type:
+    | "hello"
+    | "game_state"
+    | "resume"
+    | "resumed"
+    | "move"
+    | "chat"
+    | "game_update"
+    | "authenticate"
+    | "auth_success"
+    | "auth_error"
+    | "subscribe"
+    | "unsubscribe"
+    | "subscribed"
+    | "unsubscribed"
+    | "subscribe_error"
+    | "error";
   data: MoveData | GameUpdateData | any;
 }
 
@@ -40,6 +77,8 @@ export interface MoveData {
   y: number;
   game_id: number;
   player_id: number;
+  move_number: number;
+  color?: "black" | "white";
 }
 
 export interface GameUpdateData {
@@ -50,6 +89,23 @@ export interface GameUpdateData {
   game: Game;
 }
 
+export interface GameStateData {
+  game_id: number;
+  seq: number;
+  game: Game;
+  moves: Move[];
+  board: ("black" | "white" | "")[][];
+  captures: { black: number; white: number };
+  ko: { x: number; y: number } | null;
+  to_move: "black" | "white";
+  spectators: number;
+}
+
+export interface LobbyEvent {
+  type: "game_created" | "game_started" | "game_cancelled";
+  data: GameUpdateData;
+}
+
 export interface AuthResponse {
   token: string;
   player: Player;